@@ -0,0 +1,185 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// commandLine holds the names of the flags given on the command line
+var commandLine = make(map[string]bool)
+
+// configSources holds where each flag which is not a default was set
+var configSources = make(map[string]string)
+
+const (
+	sourceDefault     = "defaults"
+	sourceConfig      = "config file"
+	sourceHeader      = "header"
+	sourceCommandLine = "command line"
+)
+
+// recordCommandLine remembers the flags given on the command line, which
+// take precedence over the config file and the header. It has to be called
+// right after flag.Parse.
+func recordCommandLine() {
+	flag.Visit(func(f *flag.Flag) {
+		commandLine[f.Name] = true
+		configSources[f.Name] = sourceCommandLine
+	})
+}
+
+// loadConfig sets flag defaults from a TOML config file. Each top level
+// key names a flag, the value is a string, number or boolean, e.g.
+//
+//	max-vp = 80
+//	csv = "out.csv" # comments may follow values
+//	all = true
+//
+// Tables and arrays are an error. Flags given on the command line take
+// precedence.
+func loadConfig(path string) {
+	var values map[string]any
+	if _, err := toml.DecodeFile(path, &values); err != nil {
+		log.Fatalf("failed reading the config: %v", err)
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if flag.Lookup(name) == nil {
+			log.Fatalf("unknown config option %v", name)
+		}
+		value, err := configValue(values[name])
+		if err != nil {
+			log.Fatalf("invalid value for %v: %v", name, err)
+		}
+		if commandLine[name] {
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			log.Fatalf("invalid value for %v: %v", name, err)
+		}
+		configSources[name] = sourceConfig
+	}
+}
+
+// configValue formats a decoded TOML value as a flag value
+func configValue(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool, int64, float64:
+		return fmt.Sprint(v), nil
+	}
+	return "", fmt.Errorf("%T is no string, number or boolean", v)
+}
+
+// headerParamNames holds the flags which may be set from the header. They
+// only change the rules of the analysis. Input, output and exit status
+// flags are left to the command line, the header is read after the input
+// options took effect anyway.
+var headerParamNames = map[string]bool{
+	"ar-bounds":               true,
+	"ar-max":                  true,
+	"ar-min":                  true,
+	"bucket-boundary":         true,
+	"cant-friction":           true,
+	"cant-rate":               true,
+	"clothoid-clamp":          true,
+	"clothoid-max-factor":     true,
+	"clothoid-radius":         true,
+	"end-vp":                  true,
+	"inflection-tolerance":    true,
+	"length-epsilon":          true,
+	"max-cant":                true,
+	"max-curvature-rate":      true,
+	"max-grade-change":        true,
+	"max-straight-factor":     true,
+	"max-vp":                  true,
+	"max-vp-diff":             true,
+	"max-widening":            true,
+	"min-clothoid-straight":   true,
+	"min-elements":            true,
+	"min-vp":                  true,
+	"missing-clothoid-radius": true,
+	"normalize-radius-sign":   true,
+	"radius-seconds":          true,
+	"require-tangent-ends":    true,
+	"same-direction-seconds":  true,
+	"sight-offset":            true,
+	"ssd":                     true,
+	"start-vp":                true,
+	"station-tolerance":       true,
+	"straight-seconds":        true,
+	"straight-vp-mode":        true,
+	"symmetric-clothoids":     true,
+	"symmetry-tolerance":      true,
+	"target-vp":               true,
+	"target-vp-tolerance":     true,
+	"vp-boundary":             true,
+	"vp-boundary-strict":      true,
+	"vp-spike":                true,
+	"vp-spike-length":         true,
+	"widening-lanes":          true,
+	"widening-wheelbase":      true,
+}
+
+// applyHeaderParams sets the flags named in name=value cells of a header
+// row. Cells not naming a flag are ignored, flags given on the command
+// line are kept. Flags which aren't header params are an error.
+func applyHeaderParams(row []string) error {
+	for _, c := range row {
+		name, value, ok := strings.Cut(c, "=")
+		name = strings.TrimSpace(name)
+		if !ok || flag.Lookup(name) == nil {
+			continue
+		}
+		if !headerParamNames[name] {
+			return fmt.Errorf("%v can't be set from the header", name)
+		}
+		if commandLine[name] {
+			continue
+		}
+		if err := flag.Set(name, strings.TrimSpace(value)); err != nil {
+			return fmt.Errorf("invalid value for %v: %v", name, err)
+		}
+		configSources[name] = sourceHeader
+	}
+	return nil
+}
+
+// writeConfig writes the effective value of every flag as a config file,
+// grouped by where it was set in the order of precedence
+func writeConfig(w io.Writer) {
+	for _, source := range []string{sourceDefault, sourceConfig, sourceHeader, sourceCommandLine} {
+		var lines []string
+		flag.VisitAll(func(f *flag.Flag) {
+			if f.Name == "config" || f.Name == "print-config" {
+				return
+			}
+			s, ok := configSources[f.Name]
+			if !ok {
+				s = sourceDefault
+			}
+			if s != source {
+				return
+			}
+			lines = append(lines, fmt.Sprintf("%v = %q", f.Name, f.Value.String()))
+		})
+		if len(lines) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "# %v\n", source)
+		for _, line := range lines {
+			fmt.Fprintln(w, line)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	path := t.TempDir() + "/trail.toml"
+	config := `# trail defaults
+max-vp = 80 # slower
+sight-offset = 12.5
+all = true
+csv = "out # 1.csv" # quoted
+vp-bands = '80,100'
+`
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr, code := runMain(t, "-config", path, "-print-config")
+	if code != 0 {
+		t.Fatalf("exit code %v: %v", code, stderr)
+	}
+	_, fromConfig, _ := strings.Cut(stdout, "# config file\n")
+	for _, want := range []string{`all = "true"`, `max-vp = "80"`, `sight-offset = "12.5"`, `csv = "out # 1.csv"`, `vp-bands = "80,100"`} {
+		if !strings.Contains(fromConfig, want) {
+			t.Errorf("%v not applied:\n%v", want, stdout)
+		}
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	for config, want := range map[string]string{
+		"max-vp: 80\n":           "failed reading the config",
+		"max-vp = 80 trailing\n": "failed reading the config",
+		"no-such-flag = 1\n":     "unknown config option no-such-flag",
+		"[csv]\nfile = \"x\"\n":  "invalid value for csv",
+		"max-vp = [80, 90]\n":    "invalid value for max-vp",
+		"max-vp = \"fast\"\n":    "invalid value for max-vp",
+	} {
+		path := t.TempDir() + "/trail.toml"
+		if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, stderr, code := runMain(t, "-config", path, "-print-config"); code == 0 || !strings.Contains(stderr, want) {
+			t.Errorf("%q: exit code %v, want %q: %v", config, code, want, stderr)
+		}
+	}
+}
+
+func TestApplyHeaderParams(t *testing.T) {
+	setFlag(t, "max-vp", flag.Lookup("max-vp").Value.String())
+	t.Cleanup(func() { delete(configSources, "max-vp") })
+	if err := applyHeaderParams([]string{"Projekt", "max-vp = 80", "note=free text"}); err != nil {
+		t.Fatal(err)
+	}
+	if *maxVp != 80 || configSources["max-vp"] != sourceHeader {
+		t.Errorf("max-vp %v from %v, want 80 from the header", *maxVp, configSources["max-vp"])
+	}
+	for _, cell := range []string{"csv=/tmp/rv/pwned.csv", "header-rows=5", "werror=true"} {
+		if err := applyHeaderParams([]string{cell}); err == nil {
+			t.Errorf("%v accepted from the header", cell)
+		}
+	}
+}
+
+func TestHeaderParamNamesAreFlags(t *testing.T) {
+	for name := range headerParamNames {
+		// ssd is registered in main
+		if name != "ssd" && flag.Lookup(name) == nil {
+			t.Errorf("header param %v is no flag", name)
+		}
+	}
+}
+
+func TestHeaderParamsInRun(t *testing.T) {
+	input := strings.Replace(alignment("Gerade,100", "Radius,100,300", "Gerade,100"), "Datum,", "max-vp=60,", 1)
+	stdout, stderr, code := runMain(t, "-header-params", "-print-config", writeInput(t, input))
+	if code != 0 || !strings.Contains(stdout, "# header\nmax-vp = \"60\"") {
+		t.Errorf("exit code %v, max-vp not from the header:\n%v%v", code, stdout, stderr)
+	}
+	input = strings.Replace(input, "max-vp=60", "csv=out.csv", 1)
+	if _, stderr, code := runMain(t, "-header-params", writeInput(t, input)); code == 0 || !strings.Contains(stderr, "csv can't be set from the header") {
+		t.Errorf("exit code %v for an output path in the header: %v", code, stderr)
+	}
+}
+
+func TestCommandLineOverridesConfig(t *testing.T) {
+	path := t.TempDir() + "/trail.toml"
+	if err := os.WriteFile(path, []byte("max-vp = 80\nall = true\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr, code := runMain(t, "-config", path, "-max-vp", "90", "-print-config")
+	if code != 0 {
+		t.Fatalf("exit code %v: %v", code, stderr)
+	}
+	fromConfig, fromCommandLine, _ := strings.Cut(stdout, "# command line\n")
+	if !strings.Contains(fromCommandLine, `max-vp = "90"`) || strings.Contains(fromConfig, `max-vp = `) {
+		t.Errorf("the command line doesn't override the config:\n%v", stdout)
+	}
+	if !strings.Contains(fromConfig, `all = "true"`) {
+		t.Errorf("config not applied:\n%v", stdout)
+	}
+}
+
+func TestHeaderMaxVp(t *testing.T) {
+	input := strings.Replace(alignment("Gerade,200", "Radius,100,2000", "Gerade,200"), "Datum,", "max-vp=80,", 1)
+	path := writeInput(t, input)
+	radiusVp := func(args ...string) int {
+		t.Helper()
+		jsonPath := t.TempDir() + "/out.json"
+		_, stderr, code := runMain(t, append(args, "-json-out", jsonPath, path)...)
+		if code != 0 {
+			t.Fatalf("exit code %v: %v", code, stderr)
+		}
+		data, err := os.ReadFile(jsonPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out struct {
+			Elements []struct {
+				Vp int `json:"vp"`
+			} `json:"elements"`
+		}
+		if err := json.Unmarshal(data, &out); err != nil {
+			t.Fatal(err)
+		}
+		return out.Elements[1].Vp
+	}
+	if vp := radiusVp(); vp <= 80 {
+		t.Fatalf("radius has vp %v without header params", vp)
+	}
+	if vp := radiusVp("-header-params"); vp != 80 {
+		t.Errorf("got vp %v, want the header max-vp of 80", vp)
+	}
+	if vp := radiusVp("-header-params", "-max-vp", "90"); vp != 90 {
+		t.Errorf("got vp %v, want the command line max-vp of 90", vp)
+	}
+}
+
+func TestPrintConfigPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	configPath := dir + "/trail.toml"
+	if err := os.WriteFile(configPath, []byte("max-vp = 80\nmax-vp-diff = 15\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	input := strings.Replace(goldenAlignment, "Datum,", "max-vp=60,", 1)
+	stdout, stderr, code := runMain(t, "-config", configPath, "-header-params", "-max-vp", "90", "-print-config", writeInput(t, input))
+	if code != 0 {
+		t.Fatalf("exit code %v: %v", code, stderr)
+	}
+	_, fromCommandLine, _ := strings.Cut(stdout, "# command line\n")
+	if strings.Count(stdout, "max-vp = ") != 1 || !strings.Contains(fromCommandLine, `max-vp = "90"`) {
+		t.Errorf("the command line doesn't override the config and header:\n%v", stdout)
+	}
+	if !strings.Contains(stdout, "# config file\nmax-vp-diff = \"15\"\n") {
+		t.Errorf("config value missing:\n%v", stdout)
+	}
+	if hasRow(stdout, 2) || strings.Contains(stdout, "mean vp") {
+		t.Errorf("analyzed despite -print-config:\n%v", stdout)
+	}
+}
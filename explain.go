@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// explain returns why diagnostic d of element e was reported, drawing on
+// its actual value and limit
+func explain(e *Element, d Diagnostic) string {
+	var reason string
+	switch d.flag {
+	case EVpDiff:
+		reason = fmt.Sprintf("its vp %v km/h differs by %.0f km/h from a neighbor or connecting road, more than the allowed %.0f km/h",
+			e.Vp, d.Actual, d.Limit)
+	case EMinLength, ETransitionLength:
+		reason = fmt.Sprintf("its length %.1f m is below the required %.1f m (Vp %v, %v)",
+			d.Actual, d.Limit, e.Vp, e.Derivation.MinLength)
+	case ECant:
+		reason = fmt.Sprintf("its required cant of %.1f %% at vp %v km/h exceeds the maximum of %.1f %%",
+			d.Actual, e.Vp, d.Limit)
+	case EGrade:
+		reason = fmt.Sprintf("its grade of %.1f %% exceeds the maximum of %.1f %% at vp %v km/h",
+			d.Actual, d.Limit, e.Vp)
+	case ESightDistance:
+		reason = fmt.Sprintf("its radius %.1f m is below the %.1f m needed for the stopping sight distance at vp %v km/h, it is %.1f m short",
+			d.Actual, d.Limit, e.Vp, d.Limit-d.Actual)
+	case EClothoidStraight:
+		reason = fmt.Sprintf("its length %.1f m between two clothoids is below the minimum of %.1f m",
+			d.Actual, d.Limit)
+	case EMaxLength:
+		reason = fmt.Sprintf("its length %.1f m exceeds the maximum of %.1f m at vp %v km/h",
+			d.Actual, d.Limit, e.Vp)
+	case ECantTransition:
+		reason = fmt.Sprintf("its length %.1f m is below the %.1f m needed to develop the cant of %.1f %%",
+			d.Actual, d.Limit, e.Cant)
+	case EStation:
+		reason = fmt.Sprintf("its declared station %.2f m differs from the station %.2f m computed from the lengths",
+			d.Actual, d.Limit)
+	case EParameter:
+		reason = fmt.Sprintf("its parameter A %.1f m is outside the range of %.1f m to %.1f m at vp %v km/h",
+			d.Actual, e.AMin, e.AMax, e.Vp)
+	case EWidening:
+		reason = fmt.Sprintf("its required widening of %.2f m exceeds the maximum of %.2f m",
+			d.Actual, d.Limit)
+	case EARBounds:
+		reason = fmt.Sprintf("the ratio A/R of %.2f is outside the range of %.2f to %.2f",
+			d.Actual, *arMin, *arMax)
+	case EGradeChange:
+		reason = fmt.Sprintf("its grade changes by %.1f %% to a neighbor, more than the allowed %.1f %%",
+			d.Actual, d.Limit)
+	case EMaxStraight:
+		reason = fmt.Sprintf("its length %.1f m exceeds the maximum of %.1f m for a straight at vp %v km/h",
+			d.Actual, d.Limit, e.Vp)
+	case EMissingClothoid:
+		reason = fmt.Sprintf("its radius %.1f m is below %.1f m but connects to a straight without clothoid",
+			d.Actual, d.Limit)
+	case EBelowMinVp:
+		reason = fmt.Sprintf("its vp %.0f km/h is below the minimum design speed of %.0f km/h",
+			d.Actual, d.Limit)
+	case EAmbiguousClothoid:
+		reason = "it connects two radii of different size, its vp and bounds follow the tighter one"
+	case ECurvatureChange:
+		reason = fmt.Sprintf("the curvature changes by %.4f 1/m to the next curve, but the clothoids between allow only %.4f 1/m",
+			d.Actual, d.Limit)
+	case EVpSpike:
+		reason = fmt.Sprintf("its vp %v km/h differs by at least %.0f km/h from both neighbors, more than %.0f km/h",
+			e.Vp, d.Actual, d.Limit)
+	case EMergeable:
+		reason = "it continues its predecessor without any change in geometry"
+	case EBucketConflict:
+		reason = fmt.Sprintf("its length %.1f m suffices at the vp %v km/h of its radii, but is below the %.1f m required at the vp %v km/h of its straight vp bucket",
+			d.Actual, e.radiusVp, d.Limit, e.Vp)
+	case EAsymmetric:
+		reason = fmt.Sprintf("its clothoids differ by %.1f m in length, more than the allowed %.1f m",
+			d.Actual, d.Limit)
+	case EIsolatedClothoid:
+		reason = "it lies between two straights or the ends of the alignment, so there is no curvature to transition to"
+	case EInflection:
+		reason = fmt.Sprintf("its parameter A differs by %.1f m from the clothoid it meets at the inflection, more than the allowed %.1f m",
+			d.Actual, d.Limit)
+	default:
+		reason = d.Message
+	}
+	return fmt.Sprintf("Element #%v is flagged %v because %v.", e.ID, strings.Join(flagNames(d.flag, d.Severity), ", "), reason)
+}
+
+// printExplanations writes an explanation of every diagnostic of the
+// elements
+func printExplanations(w io.Writer, elements []*Element) {
+	for _, e := range elements {
+		for _, d := range e.Diagnostics {
+			fmt.Fprintln(w, explain(e, d))
+		}
+	}
+}
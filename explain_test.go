@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExplainMinLength(t *testing.T) {
+	elements := analyze(t, goldenAlignment)
+	e := elements[1]
+	want := "Element #2 is flagged MinLength because its length 40.0 m is below the required 50.0 m (Vp 85, clothoid min lengths at 85 km/h)."
+	if got := explain(e, diagnostic(t, e, EMinLength)); got != want {
+		t.Errorf("got\n%v\nwant\n%v", got, want)
+	}
+
+	elements = analyze(t, alignment("Gerade,100", "Radius,20,300", "Gerade,100"))
+	want = "Element #2 is flagged MinLength because its length 20.0 m is below the required 25.0 m (Vp 90, 1 s at vp)."
+	if got := explain(elements[1], diagnostic(t, elements[1], EMinLength)); got != want {
+		t.Errorf("got\n%v\nwant\n%v", got, want)
+	}
+
+	stdout, _, _ := runMain(t, "-explain-errors", writeInput(t, goldenAlignment))
+	if !strings.Contains(stdout, "Element #2 is flagged MinLength because its length 40.0 m is below the required 50.0 m") {
+		t.Errorf("explanation missing:\n%v", stdout)
+	}
+}
+
+func TestExplainSightDistance(t *testing.T) {
+	setFlag(t, "sight-offset", "4")
+	elements := analyze(t, alignment("Gerade,100", "Radius,100,300", "Gerade,100"))
+	want := "Element #2 is flagged SightDistance because its radius 300.0 m is below the 569.5 m needed for the stopping sight distance at vp 90 km/h, it is 269.5 m short."
+	if got := explain(elements[1], diagnostic(t, elements[1], ESightDistance)); got != want {
+		t.Errorf("got\n%v\nwant\n%v", got, want)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"log"
+)
+
+var htmlTemplate = template.Must(template.New("table").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>trail{{with index .Meta "project"}} - {{.}}{{end}}</title>
+</head>
+<body>
+{{with .Meta}}<dl>
+{{range $name, $value := .}}<dt>{{$name}}</dt><dd>{{$value}}</dd>
+{{end}}</dl>
+{{end}}<table>
+<thead>
+<tr>{{range index .Table 0}}<th>{{.}}</th>{{end}}</tr>
+</thead>
+<tbody>
+{{range slice .Table 1}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</tbody>
+</table>
+</body>
+</html>
+`))
+
+// writeHTML writes the table as a html document headed by the captured
+// metadata
+func writeHTML(w io.Writer, table [][]string) {
+	data := struct {
+		Meta  map[string]string
+		Table [][]string
+	}{metadata, table}
+	if err := htmlTemplate.Execute(w, data); err != nil {
+		log.Fatalf("failed writing data: %v", err)
+	}
+}
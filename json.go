@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// MarshalJSON encodes the type by its name
+func (t ElementType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+// UnmarshalJSON accepts the english names as well as the input's names
+func (t *ElementType) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	for elementType, s := range typeStringifications {
+		if s == name {
+			*t = elementType
+			return nil
+		}
+	}
+	if elementType, ok := typeTranslations[name]; ok {
+		*t = elementType
+		return nil
+	}
+	return fmt.Errorf("unknown type: %v", name)
+}
+
+// MarshalJSON adds the flags as names and codes as well as the computed
+// values to the element's fields
+func (e *Element) MarshalJSON() ([]byte, error) {
+	type element Element
+	var time *float64
+	if e.Vp != 0 {
+		t := traversalTime(e)
+		time = &t
+	}
+	return json.Marshal(struct {
+		*element
+		Deflection float64  `json:"deflection,omitempty"`
+		Time       *float64 `json:"time,omitempty"`
+		Errors     []string `json:"errors"`
+		Warnings   []string `json:"warnings"`
+		Codes      []string `json:"codes"`
+	}{
+		(*element)(e),
+		deflection(e),
+		time,
+		flagNames(e.Errors, SeverityError),
+		flagNames(e.Errors, SeverityWarning),
+		flagCodes(e.Errors),
+	})
+}
+
+// writeNDJSON writes one json object per line for each element, followed
+// by an object holding the summary under the key "summary"
+func writeNDJSON(w io.Writer, elements []*Element, summary Summary) {
+	enc := json.NewEncoder(w)
+	for _, e := range elements {
+		if err := enc.Encode(e); err != nil {
+			log.Fatalf("failed writing data: %v", err)
+		}
+	}
+	err := enc.Encode(struct {
+		Summary Summary `json:"summary"`
+	}{summary})
+	if err != nil {
+		log.Fatalf("failed writing data: %v", err)
+	}
+}
+
+// writeJSON writes all elements and the summary as a single json object
+func writeJSON(w io.Writer, elements []*Element, summary Summary) {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(struct {
+		Meta     map[string]string `json:"meta,omitempty"`
+		Elements []*Element        `json:"elements"`
+		Summary  Summary           `json:"summary"`
+	}{metadata, elements, summary})
+	if err != nil {
+		log.Fatalf("failed writing data: %v", err)
+	}
+}
+
+// readBaseline reads the flags of each element by id from a file written
+// with -json-out
+func readBaseline(path string) map[int]Flag {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("failed opening the baseline: %v", err)
+	}
+	defer f.Close()
+
+	var baseline struct {
+		Elements []struct {
+			ID       int      `json:"id"`
+			Errors   []string `json:"errors"`
+			Warnings []string `json:"warnings"`
+		} `json:"elements"`
+	}
+	if err := json.NewDecoder(f).Decode(&baseline); err != nil {
+		log.Fatalf("failed reading the baseline: %v", err)
+	}
+
+	result := make(map[int]Flag)
+	for _, e := range baseline.Elements {
+		names := append(e.Errors, e.Warnings...)
+		if len(names) == 0 {
+			continue
+		}
+		flags, err := parseFlagNames(strings.Join(names, ","))
+		if err != nil {
+			log.Fatalf("failed reading the baseline: element %v: %v", e.ID, err)
+		}
+		result[e.ID] |= flags
+	}
+	return result
+}
+
+// writeAudit writes one json object per element with its inputs, results
+// and how they were determined
+func writeAudit(w io.Writer, elements []*Element) {
+	enc := json.NewEncoder(w)
+	for _, e := range elements {
+		err := enc.Encode(struct {
+			ID         int         `json:"id"`
+			Index      int         `json:"index"`
+			Type       ElementType `json:"type"`
+			Length     float64     `json:"length"`
+			Radius     float64     `json:"radius,omitempty"`
+			Vp         int         `json:"vp"`
+			MinLength  float64     `json:"minLength"`
+			MaxLength  float64     `json:"maxLength,omitempty"`
+			Derivation Derivation  `json:"derivation"`
+			Errors     []string    `json:"errors"`
+			Warnings   []string    `json:"warnings"`
+		}{
+			e.ID,
+			e.Index,
+			e.Type,
+			e.Length,
+			e.Radius,
+			e.Vp,
+			e.MinLength,
+			e.MaxLength,
+			e.Derivation,
+			flagNames(e.Errors, SeverityError),
+			flagNames(e.Errors, SeverityWarning),
+		})
+		if err != nil {
+			log.Fatalf("failed writing data: %v", err)
+		}
+	}
+}
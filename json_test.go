@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestElementJSONShape(t *testing.T) {
+	common := []string{"id", "type", "length", "radius", "vp", "minLength", "maxLength",
+		"aMin", "aMax", "cant", "grade", "station", "time", "errors", "warnings", "codes"}
+	elements := analyze(t, goldenAlignment)
+	for _, c := range []struct {
+		e     *Element
+		extra []string
+	}{
+		{elements[0], []string{"nextRadiusId"}},
+		{elements[1], []string{"diagnostics"}},
+		{elements[2], []string{"deflection"}},
+	} {
+		data, err := json.Marshal(c.e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fields map[string]any
+		if err := json.Unmarshal(data, &fields); err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		want := append(slices.Clone(common), c.extra...)
+		slices.Sort(keys)
+		slices.Sort(want)
+		if !slices.Equal(keys, want) {
+			t.Errorf("%v has keys %v, want %v", c.e.Type, keys, want)
+		}
+		if fields["type"] != c.e.Type.String() {
+			t.Errorf("type %v, want %v", fields["type"], c.e.Type)
+		}
+	}
+
+	data, _ := json.Marshal(elements[1])
+	if !strings.Contains(string(data), `"errors":["MinLength"]`) || !strings.Contains(string(data), `"codes":["TRAIL-E002"]`) {
+		t.Errorf("flags missing in %s", data)
+	}
+}
+
+func TestDiagnosticsJSONRoundTrip(t *testing.T) {
+	e := analyze(t, goldenAlignment)[1]
+	e.report(EMergeable, 0, 0)
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Element
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	// the flags aren't encoded, the codes identify them
+	want := slices.Clone(e.Diagnostics)
+	for i := range want {
+		want[i].flag = 0
+	}
+	if !slices.Equal(decoded.Diagnostics, want) {
+		t.Errorf("got %+v, want %+v", decoded.Diagnostics, want)
+	}
+
+	var s Severity
+	if err := json.Unmarshal([]byte(`"fatal"`), &s); err == nil {
+		t.Error("no error for an unknown severity")
+	}
+}
+
+func TestElementTypeJSON(t *testing.T) {
+	for _, name := range []string{`"Clothoid"`, `"Klothoide"`} {
+		var typ ElementType
+		if err := json.Unmarshal([]byte(name), &typ); err != nil || typ != Clothoid {
+			t.Errorf("%v decoded to %v, %v", name, typ, err)
+		}
+	}
+	var typ ElementType
+	if err := json.Unmarshal([]byte(`"Spiral"`), &typ); err == nil {
+		t.Error("unknown type accepted")
+	}
+}
+
+func TestWriteNDJSON(t *testing.T) {
+	elements := analyze(t, goldenAlignment)
+	var out strings.Builder
+	writeNDJSON(&out, elements, Summarize(elements))
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != len(elements)+1 {
+		t.Fatalf("got %v lines, want %v", len(lines), len(elements)+1)
+	}
+	for i, line := range lines[:len(elements)] {
+		var e struct {
+			ID int `json:"id"`
+		}
+		if err := json.Unmarshal([]byte(line), &e); err != nil || e.ID != elements[i].ID {
+			t.Errorf("line %v: %v, %v", i+1, line, err)
+		}
+	}
+	var summary struct {
+		Summary Summary `json:"summary"`
+	}
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &summary); err != nil || summary.Summary.Elements != 5 || summary.Summary.Invalid != 1 {
+		t.Errorf("summary line %v: %v", lines[len(lines)-1], err)
+	}
+}
+
+func TestCSVAndJSONInOneRun(t *testing.T) {
+	dir := t.TempDir()
+	csvPath, jsonPath := dir+"/out.csv", dir+"/out.json"
+	if _, stderr, _ := runMain(t, "-all", "-csv", csvPath, "-json-out", jsonPath, writeInput(t, goldenAlignment)); stderr != "" {
+		t.Fatal(stderr)
+	}
+	f, err := os.Open(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Elements []struct {
+			ID     int     `json:"id"`
+			Length float64 `json:"length"`
+			Vp     int     `json:"vp"`
+		} `json:"elements"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != len(out.Elements)+1 || len(out.Elements) != 5 {
+		t.Fatalf("got %v csv rows and %v json elements", len(rows), len(out.Elements))
+	}
+	column := func(name string) int { return slices.Index(rows[0], name) }
+	for i, e := range out.Elements {
+		row := rows[i+1]
+		if row[column("ID")] != strconv.Itoa(e.ID) || row[column("Length")] != printFloat(e.Length) || row[column("Vp")] != strconv.Itoa(e.Vp) {
+			t.Errorf("csv row %v doesn't match json element %+v", row, e)
+		}
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	dir := t.TempDir()
+	basePath, outPath := dir+"/base.json", dir+"/out.json"
+	runMain(t, "-json-out", basePath, writeInput(t, goldenAlignment))
+
+	// element 2 stays too short, element 4 becomes too short
+	input := alignment("Gerade,120", "Klothoide,40", "Radius,80,250", "Klothoide,30", "Gerade,200")
+	stdout, _, code := runMain(t, "-strict", "-baseline", basePath, "-json-out", outPath, writeInput(t, input))
+	if code != 1 || hasRow(stdout, 2) || !hasRow(stdout, 4) {
+		t.Errorf("exit code %v, output:\n%v", code, stdout)
+	}
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Elements []struct {
+			Errors []string `json:"errors"`
+		} `json:"elements"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Elements[1].Errors) != 0 || !slices.Equal(out.Elements[3].Errors, []string{"MinLength"}) {
+		t.Errorf("got errors %v and %v", out.Elements[1].Errors, out.Elements[3].Errors)
+	}
+
+	if _, _, code := runMain(t, "-strict", "-baseline", basePath, writeInput(t, goldenAlignment)); code != 0 {
+		t.Errorf("unchanged alignment failed with exit code %v", code)
+	}
+}
+
+func TestWriteAudit(t *testing.T) {
+	elements := analyze(t, goldenAlignment)
+	var b strings.Builder
+	writeAudit(&b, elements)
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(lines) != len(elements) {
+		t.Fatalf("got %v records for %v elements", len(lines), len(elements))
+	}
+	for i, line := range lines {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range []string{"id", "index", "type", "length", "vp", "minLength", "derivation", "errors", "warnings"} {
+			if _, ok := record[key]; !ok {
+				t.Errorf("record %v lacks %v: %v", i+1, key, line)
+			}
+		}
+		derivation, _ := record["derivation"].(map[string]any)
+		if derivation["vp"] != elements[i].Derivation.Vp || derivation["minLength"] != elements[i].Derivation.MinLength || elements[i].Derivation.Vp == "" {
+			t.Errorf("record %v has derivation %v", i+1, record["derivation"])
+		}
+		if record["id"] != float64(elements[i].ID) || record["index"] != float64(i) || record["vp"] != float64(elements[i].Vp) {
+			t.Errorf("record %v doesn't match its element: %v", i+1, line)
+		}
+	}
+	if !strings.Contains(lines[1], `"errors":["MinLength"]`) || !strings.Contains(lines[2], `"radius":250`) {
+		t.Errorf("got\n%v", b.String())
+	}
+}
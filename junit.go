@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit writes a junit report with one test case per element. An
+// element fails like the whole run would, see failed, and explains its
+// diagnostics in the failure. Diagnostics which don't fail it are written
+// to its output. The diagnostics of the whole alignment form one more case.
+func writeJUnit(w io.Writer, elements []*Element, diagnostics []Diagnostic) {
+	name := "trail"
+	if project, ok := metadata["project"]; ok && project != "" {
+		name = project
+	}
+	suite := junitSuite{Name: name}
+	failing := failingFlags()
+	for _, e := range elements {
+		c := junitCase{
+			Name:      fmt.Sprintf("#%v %v", e.ID, e.Type),
+			ClassName: name,
+		}
+		var explanations, output []string
+		for _, d := range e.Diagnostics {
+			if d.flag&failing != 0 {
+				explanations = append(explanations, explain(e, d))
+			} else {
+				output = append(output, explain(e, d))
+			}
+		}
+		if flags := e.Errors & failing; flags != 0 {
+			c.Failure = &junitFailure{
+				Message: strings.Join(append(flagNames(flags, SeverityError), flagNames(flags, SeverityWarning)...), ", "),
+				Type:    stringifyCodes(flags),
+				Text:    strings.Join(explanations, "\n"),
+			}
+		}
+		c.SystemOut = strings.Join(output, "\n")
+		suite.Cases = append(suite.Cases, c)
+	}
+	if len(diagnostics) > 0 {
+		c := junitCase{Name: "alignment", ClassName: name}
+		var failures, output []string
+		for _, d := range diagnostics {
+			if d.Severity == SeverityError || *werror {
+				failures = append(failures, d.Message)
+			} else {
+				output = append(output, d.Message)
+			}
+		}
+		if len(failures) > 0 {
+			c.Failure = &junitFailure{
+				Message: failures[0],
+				Type:    "alignment",
+				Text:    strings.Join(failures, "\n"),
+			}
+		}
+		c.SystemOut = strings.Join(output, "\n")
+		suite.Cases = append(suite.Cases, c)
+	}
+	suite.Tests = len(suite.Cases)
+	for _, c := range suite.Cases {
+		if c.Failure != nil {
+			suite.Failures++
+		}
+	}
+
+	io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suite); err != nil {
+		log.Fatalf("failed writing data: %v", err)
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	elements := analyze(t, goldenAlignment)
+	elements[3].report(EMergeable, 0, 0)
+	diagnostics := []Diagnostic{
+		{Severity: SeverityWarning, Message: "only 5 elements"},
+		{Severity: SeverityError, Message: "the alignment ends with Radius 5 instead of a straight"},
+	}
+	var b strings.Builder
+	writeJUnit(&b, elements, diagnostics)
+	if !strings.HasPrefix(b.String(), xml.Header) {
+		t.Errorf("xml header missing:\n%v", b.String())
+	}
+
+	var suite struct {
+		XMLName  xml.Name `xml:"testsuite"`
+		Name     string   `xml:"name,attr"`
+		Tests    int      `xml:"tests,attr"`
+		Failures int      `xml:"failures,attr"`
+		Cases    []struct {
+			Name    string `xml:"name,attr"`
+			Failure *struct {
+				Message string `xml:"message,attr"`
+				Type    string `xml:"type,attr"`
+				Text    string `xml:",chardata"`
+			} `xml:"failure"`
+			SystemOut string `xml:"system-out"`
+		} `xml:"testcase"`
+	}
+	if err := xml.Unmarshal([]byte(b.String()), &suite); err != nil {
+		t.Fatal(err)
+	}
+	if suite.Name != "trail" || suite.Tests != 6 || suite.Failures != 2 || len(suite.Cases) != 6 {
+		t.Fatalf("got suite %v with %v tests and %v failures", suite.Name, suite.Tests, suite.Failures)
+	}
+	for i, c := range suite.Cases[:5] {
+		if want := fmt.Sprintf("#%v %v", elements[i].ID, elements[i].Type); c.Name != want {
+			t.Errorf("case %v named %q", i+1, c.Name)
+		}
+		if (c.Failure != nil) != (i == 1) {
+			t.Errorf("case %q: got failure %+v", c.Name, c.Failure)
+		}
+	}
+	if f := suite.Cases[1].Failure; f.Message != "MinLength" || f.Type != "TRAIL-E002" || !strings.HasPrefix(f.Text, "Element #2 is flagged MinLength because") {
+		t.Errorf("got failure %+v", f)
+	}
+	if out := suite.Cases[3].SystemOut; !strings.Contains(out, "Element #4 is flagged Mergeable") {
+		t.Errorf("warning not in the output: %q", out)
+	}
+	alignment := suite.Cases[5]
+	if alignment.Name != "alignment" || alignment.Failure == nil || alignment.Failure.Message != diagnostics[1].Message || alignment.SystemOut != diagnostics[0].Message {
+		t.Errorf("got alignment case %+v", alignment)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// metaCell names a cell of the header rows. The row counts from 1 like
+// -header-rows, the column from 0 like the column flags.
+type metaCell struct {
+	name string
+	row  int
+	col  int
+}
+
+// metaCells is a flag.Value of name=row:col pairs
+type metaCells []metaCell
+
+var (
+	metaFields metaCells
+
+	// metadata holds the captured header cells by name
+	metadata = make(map[string]string)
+)
+
+func (m *metaCells) String() string {
+	if m == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*m))
+	for _, c := range *m {
+		pairs = append(pairs, fmt.Sprintf("%v=%v:%v", c.name, c.row, c.col))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m *metaCells) Set(s string) error {
+	for _, pair := range strings.Split(s, ",") {
+		name, ref, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("missing = in %v", pair)
+		}
+		r, c, ok := strings.Cut(ref, ":")
+		if !ok {
+			return fmt.Errorf("missing : in %v", pair)
+		}
+		row, err := strconv.Atoi(strings.TrimSpace(r))
+		if err != nil {
+			return err
+		}
+		col, err := strconv.Atoi(strings.TrimSpace(c))
+		if err != nil {
+			return err
+		}
+		*m = append(*m, metaCell{strings.TrimSpace(name), row, col})
+	}
+	return nil
+}
+
+// captureMeta stores the cells of header row line which are requested by
+// -meta
+func captureMeta(line int, row []string) {
+	for _, c := range metaFields {
+		if c.row == line {
+			metadata[c.name] = strings.TrimSpace(cell(row, c.col))
+		}
+	}
+}
+
+// writeBanner writes the captured header cells in the order of -meta
+func writeBanner(w io.Writer) {
+	for _, c := range metaFields {
+		fmt.Fprintf(w, "%v: %v\n", c.name, metadata[c.name])
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCaptureMeta(t *testing.T) {
+	oldFields, oldData := metaFields, metadata
+	t.Cleanup(func() { metaFields, metadata = oldFields, oldData })
+	metaFields, metadata = nil, make(map[string]string)
+
+	if err := metaFields.Set("project=1:1, date = 2:1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := metaFields.String(); got != "project=1:1,date=2:1" {
+		t.Errorf("got %q", got)
+	}
+	for _, bad := range []string{"project", "project=1", "project=a:1", "project=1:b"} {
+		var m metaCells
+		if err := m.Set(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+
+	opts := optionsFromFlags()
+	opts.Header = func(line int, row []string) error {
+		captureMeta(line, row)
+		return nil
+	}
+	if _, _, err := Parse(strings.NewReader(goldenAlignment), opts); err != nil {
+		t.Fatal(err)
+	}
+	if metadata["project"] != "B1" || metadata["date"] != "2020-01-01" {
+		t.Errorf("got metadata %v", metadata)
+	}
+	var b strings.Builder
+	writeBanner(&b)
+	if want := "project: B1\ndate: 2020-01-01\n"; b.String() != want {
+		t.Errorf("got banner %q, want %q", b.String(), want)
+	}
+
+	jsonPath := t.TempDir() + "/out.json"
+	stdout, _, _ := runMain(t, "-meta", "project=1:1", "-json-out", jsonPath, writeInput(t, goldenAlignment))
+	if !strings.HasPrefix(stdout, "project: B1\n") {
+		t.Errorf("banner missing:\n%v", stdout)
+	}
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Meta map[string]string `json:"meta"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil || out.Meta["project"] != "B1" {
+		t.Errorf("got meta %v, %v", out.Meta, err)
+	}
+}
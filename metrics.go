@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// writeMetrics writes the results in the Prometheus text exposition format,
+// suitable for the node exporter's textfile collector
+func writeMetrics(w io.Writer, elements []*Element, summary Summary) {
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(w, "# HELP %v %v\n", name, help)
+		fmt.Fprintf(w, "# TYPE %v %v\n", name, kind)
+	}
+
+	metric("trail_elements_total", "gauge", "Number of analyzed elements.")
+	fmt.Fprintf(w, "trail_elements_total %v\n", summary.Elements)
+
+	metric("trail_elements_with_errors", "gauge", "Number of elements with at least one flag.")
+	fmt.Fprintf(w, "trail_elements_with_errors %v\n", summary.Invalid)
+
+	metric("trail_length_meters", "gauge", "Total length of all elements.")
+	fmt.Fprintf(w, "trail_length_meters %v\n", summary.TotalLength)
+
+	if summary.HasMeanVp {
+		metric("trail_mean_vp", "gauge", "Length weighted mean vp in km/h.")
+		fmt.Fprintf(w, "trail_mean_vp %v\n", summary.MeanVp)
+	}
+
+	metric("trail_flagged_elements", "gauge", "Number of elements carrying a flag.")
+	for _, info := range flagInfos {
+		count := 0
+		for _, e := range elements {
+			if e.Errors&info.flag != 0 {
+				count++
+			}
+		}
+		fmt.Fprintf(w, "trail_flagged_elements{flag=%q,code=%q,severity=%q} %v\n",
+			info.name,
+			info.code,
+			info.severity,
+			count)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	elements := analyze(t, goldenAlignment)
+	var b strings.Builder
+	writeMetrics(&b, elements, Summarize(elements))
+
+	sample := regexp.MustCompile(`^([a-z_]+)(\{(?:[a-z]+="[^"]*",?)*\})? (\S+)$`)
+	typed := map[string]bool{}
+	series := map[string]float64{}
+	for _, line := range strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n") {
+		if fields := strings.Fields(line); len(fields) >= 4 && fields[0] == "#" {
+			switch fields[1] {
+			case "HELP":
+			case "TYPE":
+				typed[fields[2]] = true
+			default:
+				t.Errorf("unknown comment %q", line)
+			}
+			continue
+		}
+		m := sample.FindStringSubmatch(line)
+		if m == nil {
+			t.Errorf("malformed sample %q", line)
+			continue
+		}
+		if !typed[m[1]] {
+			t.Errorf("sample %q without type", line)
+		}
+		value, err := strconv.ParseFloat(m[3], 64)
+		if err != nil {
+			t.Errorf("sample %q: %v", line, err)
+		}
+		series[m[1]+m[2]] = value
+	}
+
+	for name, want := range map[string]float64{
+		"trail_elements_total":       5,
+		"trail_elements_with_errors": 1,
+		"trail_length_meters":        500,
+		`trail_flagged_elements{flag="MinLength",code="TRAIL-E002",severity="error"}`: 1,
+		`trail_flagged_elements{flag="VpDiff",code="TRAIL-E001",severity="error"}`:    0,
+	} {
+		if got, ok := series[name]; !ok || got != want {
+			t.Errorf("%v: got %v, want %v", name, got, want)
+		}
+	}
+	if _, ok := series["trail_mean_vp"]; !ok {
+		t.Error("trail_mean_vp missing")
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// sortedKeys returns the keys of m in ascending order. Ranging over a map
+// directly yields a random order, so every output derived from a map has
+// to go through here.
+func sortedKeys[K cmp.Ordered, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// writeRules writes the effective rule tables in a stable order
+func writeRules(w io.Writer) {
+	fmt.Fprintln(w, "straight vps (vp: max lengths in m):")
+	for _, vp := range sortedKeys(straightVps) {
+		fmt.Fprintf(w, "  %v: %v\n", vp, straightVps[vp])
+	}
+
+	fmt.Fprintln(w, "clothoid min lengths (vp: m):")
+	for _, vp := range sortedKeys(clothoidMinLengths) {
+		fmt.Fprintf(w, "  %v: %v\n", vp, clothoidMinLengths[vp])
+	}
+
+	fmt.Fprintln(w, "max grades (vp: %):")
+	for _, vp := range sortedKeys(maxGrades) {
+		fmt.Fprintf(w, "  %v: %v\n", vp, maxGrades[vp])
+	}
+
+	fmt.Fprintln(w, "sight distances (vp: m):")
+	for _, vp := range sortedKeys(sightDistances) {
+		fmt.Fprintf(w, "  %v: %v\n", vp, sightDistances[vp])
+	}
+
+	fmt.Fprintln(w, "type translations:")
+	for _, name := range sortedKeys(typeTranslations) {
+		fmt.Fprintf(w, "  %v: %v\n", name, typeTranslations[name])
+	}
+
+	fmt.Fprintln(w, "limits:")
+	fmt.Fprintf(w, "  max vp: %v\n", *maxVp)
+	fmt.Fprintf(w, "  max straight vp: %v\n", MaxStraightVp)
+	fmt.Fprintf(w, "  max vp difference: %v\n", *maxVpDiff)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSortedKeys(t *testing.T) {
+	if got := sortedKeys(straightVps); !slices.Equal(got, []int{40, 50, 60, 70, 80, 90}) {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestWriteRulesStable(t *testing.T) {
+	var first strings.Builder
+	writeRules(&first)
+	for range 20 {
+		var b strings.Builder
+		writeRules(&b)
+		if b.String() != first.String() {
+			t.Fatalf("output changed:\n%v\nthen\n%v", first.String(), b.String())
+		}
+	}
+	if !strings.Contains(first.String(), "straight vps (vp: max lengths in m):\n  40: [30 100 180 270 380 500]\n  50: ") {
+		t.Errorf("straight vps not sorted:\n%v", first.String())
+	}
+
+	// each process seeds the map iteration differently
+	stdout, _, code := runMain(t, "-dump-rules")
+	for range 3 {
+		if again, _, _ := runMain(t, "-dump-rules"); code != 0 || again != stdout {
+			t.Fatalf("exit code %v, output changed:\n%v\nthen\n%v", code, stdout, again)
+		}
+	}
+	if stdout != first.String() {
+		t.Errorf("-dump-rules printed\n%v\nwant\n%v", stdout, first.String())
+	}
+}
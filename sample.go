@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"log"
+	"math/rand"
+	"strconv"
+)
+
+// writeSample writes an input file with n elements in the default column
+// layout, repeating straight, clothoid, radius, clothoid. Lengths and radii
+// vary so that some elements fail. The same n always yields the same file.
+func writeSample(w io.Writer, n int) {
+	random := rand.New(rand.NewSource(int64(n)))
+	radii := []float64{60, 120, 250, 300, 450, 800}
+	between := func(lo, hi int) int {
+		return lo + random.Intn(hi-lo+1)
+	}
+
+	out := csv.NewWriter(w)
+	out.Write([]string{"Projekt", "Sample", "", "", "", "", ""})
+	out.Write([]string{"Datum", "2020-01-01", "", "", "", "", ""})
+	out.Write([]string{"Id", "Typ", "Station", "Länge", "A", "", "Radius"})
+	station := 0
+	for i := 0; i < n; i++ {
+		var typ, radius string
+		var length int
+		switch i % 4 {
+		case 0:
+			typ, length = "Gerade", between(20, 400)
+		case 2:
+			r := radii[random.Intn(len(radii))]
+			if random.Intn(2) == 0 {
+				r = -r
+			}
+			typ, length, radius = "Radius", between(40, 200), strconv.FormatFloat(r, 'f', -1, 64)
+		default:
+			typ, length = "Klothoide", between(25, 80)
+		}
+		out.Write([]string{
+			strconv.Itoa(i + 1),
+			typ,
+			strconv.Itoa(station),
+			strconv.Itoa(length),
+			"",
+			"",
+			radius,
+		})
+		station += length
+	}
+	out.Write([]string{"Summe", "", "", strconv.Itoa(station), "", "", ""})
+	out.Flush()
+	if err := out.Error(); err != nil {
+		log.Fatalf("failed writing data: %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSampleRoundTrip(t *testing.T) {
+	for _, n := range []int{1, 4, 57} {
+		elements := parse(t, sampleInput(n))
+		if len(elements) != n {
+			t.Fatalf("sample of %v elements parsed to %v", n, len(elements))
+		}
+		types := []ElementType{Straight, Clothoid, Radius, Clothoid}
+		for i, e := range elements {
+			if e.ID != i+1 || e.Type != types[i%4] || e.Length <= 0 {
+				t.Errorf("element %v: %+v", i+1, e)
+			}
+			if (e.Type == Radius) != (e.Radius != 0) {
+				t.Errorf("element %v: %v with radius %v", e.ID, e.Type, e.Radius)
+			}
+		}
+	}
+
+	elements := analyze(t, sampleInput(200))
+	if invalid := Summarize(elements).Invalid; invalid == 0 || invalid == len(elements) {
+		t.Errorf("%v of %v elements invalid", invalid, len(elements))
+	}
+
+	stdout, _, code := runMain(t, "-generate-sample", "8")
+	if code != 0 || stdout != sampleInput(8) {
+		t.Errorf("exit code %v, output:\n%v", code, stdout)
+	}
+	var total float64
+	for _, e := range parse(t, stdout) {
+		total += e.Length
+	}
+	if footer := fmt.Sprintf("\nSumme,,,%v,,,\n", total); !strings.HasSuffix(stdout, footer) {
+		t.Errorf("footer %q missing:\n%v", footer, stdout)
+	}
+}
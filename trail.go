@@ -1,15 +1,23 @@
 package main
 
 import (
+	"bufio"
 	"encoding/csv"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/olekukonko/tablewriter"
+	"golang.org/x/text/encoding/htmlindex"
+	"io"
 	"log"
+	"log/slog"
 	"math"
 	"os"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 // ElementType is one of Straight, Clothoid or Radius
@@ -20,15 +28,71 @@ type Flag uint
 
 // Element is one trail element
 type Element struct {
-	ID        int
-	Type      ElementType
-	Length    float64
-	Radius    float64
-	Vp        int
-	MinLength float64
-	AMin      float64
-	AMax      float64
-	Errors    Flag
+	ID        int         `json:"id"`
+	OrigID    int         `json:"origId,omitempty"`
+	Type      ElementType `json:"type"`
+	Length    float64     `json:"length"`
+	Radius    float64     `json:"radius"`
+	Vp        int         `json:"vp"`
+	MinLength float64     `json:"minLength"`
+	MaxLength float64     `json:"maxLength"`
+	AMin      float64     `json:"aMin"`
+	AMax      float64     `json:"aMax"`
+	Cant      float64     `json:"cant"`
+	Grade     float64     `json:"grade"`
+	Station   float64     `json:"station"`
+	Index     int         `json:"-"`
+
+	// how vp and minimum length were determined
+	Derivation Derivation `json:"-"`
+
+	// findings about the element, Errors holds their flags
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+
+	// ids of the radii a straight's vp derives from, 0 if there is none
+	PrevRadiusID int     `json:"prevRadiusId,omitempty"`
+	NextRadiusID int     `json:"nextRadiusId,omitempty"`
+	Widening     float64 `json:"widening,omitempty"`
+	Clamped      bool    `json:"clamped,omitempty"`
+	Errors       Flag    `json:"-"`
+
+	// coordinates of the element's start point, if read from the input
+	X         float64 `json:"x,omitempty"`
+	Y         float64 `json:"y,omitempty"`
+	HasCoords bool    `json:"-"`
+
+	// start elevation and grade, if read from the input
+	Elevation    float64 `json:"elevation,omitempty"`
+	HasElevation bool    `json:"-"`
+	HasGrade     bool    `json:"-"`
+
+	// start station, if read from the input
+	DeclaredStation    float64 `json:"declaredStation,omitempty"`
+	HasDeclaredStation bool    `json:"-"`
+
+	// clothoid parameter A, if read from the input
+	AActual float64 `json:"a,omitempty"`
+	HasA    bool    `json:"-"`
+
+	// free text passed through from the input
+	Label string `json:"label,omitempty"`
+
+	// turn sense, 1 for right, -1 for left and 0 if unknown. It is read
+	// from the input and replaced by the radius sign during the analysis.
+	Turn int `json:"-"`
+
+	// vp of the radii a straight's vp derives from, before the straight vp
+	// buckets raise it
+	radiusVp int
+}
+
+// Derivation records the rules which determined an element's vp and
+// minimum length
+type Derivation struct {
+	Vp        string `json:"vp"`
+	MinLength string `json:"minLength"`
+	// ids of the elements the vp derives from
+	Sources []int `json:"sources,omitempty"`
 }
 
 // ElementTypes for constructing a trail
@@ -42,14 +106,105 @@ const (
 const (
 	EVpDiff Flag = 1 << iota
 	EMinLength
+	EAmbiguousClothoid
+	ECant
+	EGrade
+	ESightDistance
+	EClothoidStraight
+	EMaxLength
+	ECurvatureChange
+	EVpSpike
+	EMergeable
+	ECantTransition
+	EStation
+	EParameter
+	EWidening
+	ETransitionLength
+	EARBounds
+	EGradeChange
+	EMaxStraight
+	EMissingClothoid
+	EBelowMinVp
+	EBucketConflict
+	EAsymmetric
+	EIsolatedClothoid
+	EInflection
+)
+
+// Severities of findings
+const (
+	SeverityWarning Severity = iota
+	SeverityError
 )
 
-// Highest Vps to design for
+// Severity of a diagnostic
+type Severity int
+
+// MarshalText encodes the severity by its name
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes the severity from its name
+func (s *Severity) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "error":
+		*s = SeverityError
+	case "warning":
+		*s = SeverityWarning
+	default:
+		return fmt.Errorf("unknown severity %q", text)
+	}
+	return nil
+}
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// Diagnostic is a finding about the whole alignment or a single element.
+// Findings about an element also carry the code of their flag and, if the
+// check compares values, the actual value and the limit it violates.
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code,omitempty"`
+	Message  string   `json:"message"`
+	Actual   float64  `json:"actual,omitempty"`
+	Limit    float64  `json:"limit,omitempty"`
+
+	flag Flag
+}
+
+// flagInfo holds the human readable name, the machine readable code and the
+// severity of an error flag
+type flagInfo struct {
+	flag     Flag
+	name     string
+	code     string
+	severity Severity
+}
+
+// vpTable maps vps to values. As a flag it accepts comma separated
+// vp=value pairs which are added to or replace existing entries.
+type vpTable map[int]float64
+
+// Highest Vps to design for, MaxVp is the default of -max-vp
 const (
 	MaxVp         int = 100
 	MaxStraightVp int = 100
 )
 
+// MaxCoordRadius is the radius above which a curve computed from
+// coordinates is considered a straight
+const MaxCoordRadius float64 = 1e6
+
+// MaxVpDiff is the default largest allowed Vp difference between adjacent
+// elements
+const MaxVpDiff int = 20
+
 var (
 	straightVps = map[int][]float64{
 		40: []float64{30, 100, 180, 270, 380, 500},
@@ -79,6 +234,118 @@ var (
 		130: 72,
 	}
 
+	// flagInfos lists all error flags in reporting order. The codes are
+	// stable identifiers for integrations and must never be reused:
+	//
+	//	TRAIL-E001  VpDiff             vp difference to a neighbor is too large
+	//	TRAIL-E002  MinLength          element is shorter than its minimum length
+	//	TRAIL-E003  Cant               required cant exceeds the maximum
+	//	TRAIL-E004  Grade              gradient exceeds the maximum for the vp
+	//	TRAIL-E005  SightDistance      radius too tight for the stopping sight distance
+	//	TRAIL-E006  ClothoidStraight   straight between two clothoids is too short
+	//	TRAIL-E007  MaxLength          clothoid is longer than its maximum length
+	//	TRAIL-E008  CantTransition     clothoid too short to develop the cant
+	//	TRAIL-E009  Station            first element whose station disagrees with the lengths
+	//	TRAIL-E010  Parameter          clothoid parameter A outside AMin..AMax
+	//	TRAIL-E011  Widening           required curve widening exceeds the maximum
+	//	TRAIL-E012  ARBounds           clothoid parameter A outside R/3..R
+	//	TRAIL-E013  GradeChange        grade change to a neighbor is too large
+	//	TRAIL-E014  MaxStraight        straight is longer than its maximum length
+	//	TRAIL-E015  MissingClothoid    tight radius connects to a straight without clothoid
+	//	TRAIL-E016  BelowMinVp         vp is below the minimum design speed
+	//	TRAIL-W001  AmbiguousClothoid  clothoid connects two different radii
+	//	TRAIL-W002  CurvatureChange    curvature changes too fast between two curves
+	//	TRAIL-W003  VpSpike            short element with a vp above or below both neighbors
+	//	TRAIL-W004  Mergeable          element could be merged with its predecessor
+	//	TRAIL-W005  TransitionLength   clothoid with given A is shorter than its minimum length
+	//	TRAIL-W006  BucketConflict     straight is only too short for the vp of its bucket
+	//	TRAIL-W007  Asymmetric         clothoids around a radius differ in length
+	//	TRAIL-W008  IsolatedClothoid   clothoid between two straights or the ends of the alignment
+	//	TRAIL-W009  Inflection         clothoids meeting at an inflection differ in parameter A
+	flagInfos = []flagInfo{
+		{EVpDiff, "VpDiff", "TRAIL-E001", SeverityError},
+		{EMinLength, "MinLength", "TRAIL-E002", SeverityError},
+		{ECant, "Cant", "TRAIL-E003", SeverityError},
+		{EGrade, "Grade", "TRAIL-E004", SeverityError},
+		{ESightDistance, "SightDistance", "TRAIL-E005", SeverityError},
+		{EClothoidStraight, "ClothoidStraight", "TRAIL-E006", SeverityError},
+		{EMaxLength, "MaxLength", "TRAIL-E007", SeverityError},
+		{ECantTransition, "CantTransition", "TRAIL-E008", SeverityError},
+		{EStation, "Station", "TRAIL-E009", SeverityError},
+		{EParameter, "Parameter", "TRAIL-E010", SeverityError},
+		{EWidening, "Widening", "TRAIL-E011", SeverityError},
+		{EARBounds, "ARBounds", "TRAIL-E012", SeverityError},
+		{EGradeChange, "GradeChange", "TRAIL-E013", SeverityError},
+		{EMaxStraight, "MaxStraight", "TRAIL-E014", SeverityError},
+		{EMissingClothoid, "MissingClothoid", "TRAIL-E015", SeverityError},
+		{EBelowMinVp, "BelowMinVp", "TRAIL-E016", SeverityError},
+		{EAmbiguousClothoid, "AmbiguousClothoid", "TRAIL-W001", SeverityWarning},
+		{ECurvatureChange, "CurvatureChange", "TRAIL-W002", SeverityWarning},
+		{EVpSpike, "VpSpike", "TRAIL-W003", SeverityWarning},
+		{EMergeable, "Mergeable", "TRAIL-W004", SeverityWarning},
+		{ETransitionLength, "TransitionLength", "TRAIL-W005", SeverityWarning},
+		{EBucketConflict, "BucketConflict", "TRAIL-W006", SeverityWarning},
+		{EAsymmetric, "Asymmetric", "TRAIL-W007", SeverityWarning},
+		{EIsolatedClothoid, "IsolatedClothoid", "TRAIL-W008", SeverityWarning},
+		{EInflection, "Inflection", "TRAIL-W009", SeverityWarning},
+	}
+
+	// maximum longitudinal gradients in percent
+	maxGrades = map[int]float64{
+		40:  12,
+		45:  11,
+		50:  10,
+		55:  9,
+		60:  8,
+		65:  7.5,
+		70:  7,
+		75:  6.5,
+		80:  6,
+		85:  5.5,
+		90:  5,
+		95:  4.5,
+		100: 4.5,
+		110: 4,
+		120: 4,
+		130: 4,
+	}
+
+	// stopping sight distances in m
+	sightDistances = vpTable{
+		40:  35,
+		45:  40,
+		50:  50,
+		55:  55,
+		60:  65,
+		65:  75,
+		70:  85,
+		75:  95,
+		80:  110,
+		85:  120,
+		90:  135,
+		95:  150,
+		100: 165,
+		110: 200,
+		120: 240,
+		130: 280,
+	}
+
+	// headerAliases maps lower case column names to their column index
+	headerAliases = map[string]func(c *Columns) *int{
+		"id":        func(c *Columns) *int { return &c.ID },
+		"nr":        func(c *Columns) *int { return &c.ID },
+		"typ":       func(c *Columns) *int { return &c.Type },
+		"type":      func(c *Columns) *int { return &c.Type },
+		"länge":     func(c *Columns) *int { return &c.Length },
+		"laenge":    func(c *Columns) *int { return &c.Length },
+		"length":    func(c *Columns) *int { return &c.Length },
+		"radius":    func(c *Columns) *int { return &c.Radius },
+		"a":         func(c *Columns) *int { return &c.A },
+		"label":     func(c *Columns) *int { return &c.Label },
+		"direction": func(c *Columns) *int { return &c.Direction },
+		"richtung":  func(c *Columns) *int { return &c.Direction },
+	}
+
 	typeTranslations = map[string]ElementType{
 		"Gerade":    Straight,
 		"Radius":    Radius,
@@ -91,376 +358,2664 @@ var (
 		Clothoid: "Clothoid",
 	}
 
-	printAll  = flag.Bool("all", false, "print all elemenets")
-	exportCSV = flag.String("csv", "", "export table to a csv file")
+	printAll              = flag.Bool("all", false, "print all elemenets")
+	exportCSV             = flag.String("csv", "", "export table to a csv file")
+	vpBoundary            = flag.Int("vp-boundary", 100, "vp at which the stricter vp difference rule applies")
+	vpBoundaryStrict      = flag.Bool("vp-boundary-strict", true, "treat a vp difference of exactly the maximum as invalid at the boundary vp")
+	showProgress          = flag.Bool("progress", false, "print progress to stderr if it is a terminal")
+	checkTotal            = flag.Bool("check-total", false, "compare the summed length against the total in the footer row")
+	totalTolerance        = flag.Float64("total-tolerance", 0.1, "allowed difference between summed and declared total length")
+	showCodes             = flag.Bool("codes", false, "add a column with machine readable error codes")
+	strict                = flag.Bool("strict", false, "exit with status 1 if errors are found")
+	werror                = flag.Bool("werror", false, "treat warnings as errors (implies -strict)")
+	colX                  = flag.Int("col-x", -1, "column of the start point's x coordinate (-1 to disable)")
+	colY                  = flag.Int("col-y", -1, "column of the start point's y coordinate (-1 to disable)")
+	contextRows           = flag.Int("context", 0, "also print this many elements around each invalid element")
+	configFile            = flag.String("config", "", "read flag defaults from a TOML file of name = value lines")
+	cantFriction          = flag.Float64("cant-friction", 0.3, "side friction coefficient taken into account for the cant")
+	maxCant               = flag.Float64("max-cant", 0, "maximum allowed cant in percent, e.g. 7 (0 to disable)")
+	colGrade              = flag.Int("col-grade", -1, "column of the gradient in percent (-1 to disable)")
+	colElevation          = flag.Int("col-elevation", -1, "column of the start elevation (-1 to disable)")
+	csvErrorsOnly         = flag.Bool("csv-errors-only", false, "only export invalid elements to the csv file")
+	minClothoidGap        = flag.Float64("min-clothoid-straight", 0, "minimum length of a straight between two clothoids (0 to disable)")
+	sightOffset           = flag.Float64("sight-offset", 10, "lateral clearance from the driving line to sight obstructions in curves")
+	countOnly             = flag.Bool("count", false, "only print the number of invalid elements")
+	clothoidRadius        = flag.String("clothoid-radius", "transition", "radius clothoid bounds derive from: transition (adjacent radii, tighter one if two) or nearest")
+	maxCurvatureRate      = flag.Float64("max-curvature-rate", 0, "maximum curvature change per m between consecutive curves in 1/m² (0 to disable)")
+	meanMinLength         = flag.Float64("mean-min-length", 0, "additionally print the mean vp of elements at least this long")
+	colID                 = flag.Int("col-id", 0, "column of the id")
+	strictColumns         = flag.Bool("strict-columns", false, "require all rows to have as many columns as the header")
+	colLength             = flag.Int("col-length", 3, "column of the length")
+	colType               = flag.Int("col-type", 1, "column of the element type")
+	headerMap             = flag.Int("header-map", 0, "header row whose column names set the columns (0 to disable)")
+	colRadius             = flag.Int("col-radius", 6, "column of the radius")
+	renumber              = flag.Bool("renumber", false, "number elements sequentially and keep the original ids in a separate column")
+	renumberBase          = flag.Int("renumber-base", 1, "first id when renumbering")
+	vpSpike               = flag.Int("vp-spike", 0, "flag short elements whose vp differs by more than this from both neighbors in the same direction (0 to disable)")
+	vpSpikeLength         = flag.Float64("vp-spike-length", 200, "maximum length of elements checked for vp spikes")
+	parseOnly             = flag.Bool("parse-only", false, "only check that all rows can be parsed")
+	ndjson                = flag.Bool("ndjson", false, "print one json object per element followed by the summary instead of the table")
+	bucketBoundary        = flag.String("bucket-boundary", "inclusive", "whether a straight as long as a vp bucket limit belongs to that bucket: inclusive or exclusive")
+	mergeAdjacent         = flag.Bool("merge-adjacent", false, "merge adjacent straights and adjacent radii of equal radius before the analysis")
+	checkMergeableFlag    = flag.Bool("check-mergeable", false, "warn about adjacent straights and adjacent radii of equal radius which could be merged")
+	showTotals            = flag.Bool("totals", false, "append a row with the totals of all elements to the table")
+	csvTotals             = flag.Bool("csv-totals", false, "append a row with the totals of all elements to the csv file")
+	jsonOut               = flag.String("json-out", "", "export all elements and the summary to a json file")
+	htmlOut               = flag.String("html", "", "export the table to a html file")
+	headerRows            = flag.Int("header-rows", 3, "number of header rows to skip")
+	footerRows            = flag.Int("footer-rows", 1, "number of footer rows to skip")
+	requireElements       = flag.Bool("require-elements", false, "exit with status 1 if no elements were found (implied by -strict)")
+	cantRate              = flag.Float64("cant-rate", 0, "maximum change of the cant along clothoids in percent per m, e.g. 0.2 (0 to disable)")
+	profileCSV            = flag.String("profile-csv", "", "export the vp along the alignment to a csv file")
+	profileStep           = flag.Float64("profile-step", 0, "sample the vp profile every this many meters (0 for each element start)")
+	inputEncoding         = flag.String("encoding", "", "encoding of the input, e.g. windows-1252 (default utf-8)")
+	colStation            = flag.Int("col-station", -1, "column of the start station, checked against the lengths (-1 to disable)")
+	stationTolerance      = flag.Float64("station-tolerance", 0.1, "allowed difference between declared and computed stations")
+	maxRows               = flag.Int("max-rows", 0, "print at most this many rows of the table (0 for all)")
+	worst                 = flag.Int("worst", 0, "list this many flagged elements with the highest severity after the table")
+	colA                  = flag.Int("col-a", -1, "column of the clothoid parameter A (-1 to disable)")
+	targetVp              = flag.Int("target-vp", 0, "target design speed the mean vp has to reach (0 to disable)")
+	targetVpTolerance     = flag.Float64("target-vp-tolerance", 0, "km/h the mean vp may fall below the target vp")
+	dumpRules             = flag.Bool("dump-rules", false, "print the effective rule tables and exit")
+	clothoidClamp         = flag.Bool("clothoid-clamp", false, "use the nearest clothoid length table entry for vps missing from it")
+	clothoidMaxFactor     = flag.Float64("clothoid-max-factor", 0, "maximum clothoid length as a multiple of its minimum length, e.g. 2 (0 to disable)")
+	metricsOut            = flag.String("metrics", "", "export prometheus metrics to a file")
+	straightVpMode        = flag.String("straight-vp-mode", "max", "how the vps of the radii around a straight combine: max, min or avg")
+	tui                   = flag.Bool("tui", false, "browse all elements in an interactive terminal ui, sorting and filtering them")
+	wheelbase             = flag.Float64("widening-wheelbase", 0, "wheelbase in m of the design vehicle for the curve widening (0 to disable)")
+	wideningLanes         = flag.Int("widening-lanes", 2, "number of lanes to widen")
+	maxWidening           = flag.Float64("max-widening", 0, "maximum curve widening in m (0 to disable)")
+	minElements           = flag.Int("min-elements", 3, "warn if the alignment has fewer elements (0 to disable)")
+	csvRaw                = flag.Bool("csv-raw", false, "export floats in the csv with full precision")
+	colLabel              = flag.Int("col-label", -1, "column of a free text label passed through to the output (-1 to disable)")
+	failOn                = flag.String("fail-on", "", "comma separated flag names which exit with status 1, e.g. VpDiff,MinLength (default all errors with -strict)")
+	startVp               = flag.Int("start-vp", 0, "vp of the connecting road before the first element (0 to disable)")
+	endVp                 = flag.Int("end-vp", 0, "vp of the connecting road after the last element (0 to disable)")
+	reportClamped         = flag.Bool("report-clamped", false, "list radii whose vp is clamped to the maximum vp")
+	color                 = flag.Bool("color", false, "color rows by severity: yellow for warnings and marginal lengths, red for errors")
+	colorGross            = flag.Float64("color-gross", 10, "percent below the minimum length from which a length error is colored red")
+	arBounds              = flag.Bool("ar-bounds", false, "check the clothoid parameter A against fractions of the radius")
+	arMin                 = flag.Float64("ar-min", 1.0/3, "smallest allowed A as a fraction of the radius")
+	arMax                 = flag.Float64("ar-max", 1, "largest allowed A as a fraction of the radius")
+	baselineFile          = flag.String("baseline", "", "suppress flags already present in this -json-out file, matching elements by id")
+	tsv                   = flag.Bool("tsv", false, "print the table as tab separated values")
+	maxGradeChange        = flag.Float64("max-grade-change", 0, "maximum algebraic grade difference in percent between adjacent elements (0 to disable)")
+	generateSample        = flag.Int("generate-sample", 0, "print a sample input with this many elements and exit")
+	showEnergy            = flag.Bool("energy", false, "print a rough estimate of the energy needed to drive the alignment")
+	vehicleMass           = flag.Float64("energy-mass", 1500, "vehicle mass in kg for the energy estimate")
+	rollingResistance     = flag.Float64("energy-rolling", 0.015, "rolling resistance coefficient for the energy estimate")
+	colDirection          = flag.Int("col-direction", -1, "column of the turn direction, L or R (-1 to disable)")
+	normalizeRadiusSign   = flag.Bool("normalize-radius-sign", false, "sign radii by their turn direction, right positive and left negative")
+	showIndex             = flag.Bool("show-index", false, "show the zero based position of elements in the table and messages")
+	maxStraightFactor     = flag.Float64("max-straight-factor", 0, "maximum straight length in m as a multiple of its vp, e.g. 20 (0 to disable)")
+	vpBands               = flag.String("vp-bands", "", "report the length per vp band split at these comma separated vps, e.g. 80,100")
+	showNeighbors         = flag.Bool("show-neighbors", false, "show the radii the vp of straights derives from")
+	autoFooter            = flag.Bool("auto-footer", false, "detect the footer rows by their id not being a number instead of using -footer-rows")
+	radiusSeconds         = flag.Float64("radius-seconds", 1, "seconds of driving at vp a radius has to last at least")
+	straightSeconds       = flag.Float64("straight-seconds", 1, "seconds of driving at vp a straight has to last at least")
+	sameDirectionSeconds  = flag.Float64("same-direction-seconds", 5, "seconds of driving at vp a straight between radii in the same direction has to last at least")
+	maxColWidth           = flag.Int("max-col-width", 0, "truncate cells of the printed table to this many characters (0 to disable)")
+	missingClothoidRadius = flag.Float64("missing-clothoid-radius", 0, "radii below this need a clothoid to an adjacent straight (0 to disable)")
+	minVp                 = flag.Int("min-vp", 0, "minimum design speed no element may fall below (0 to disable)")
+	auditOut              = flag.String("audit", "", "export how each element was analyzed as json lines to a file")
+	summaryKV             = flag.Bool("summary-kv", false, "print only the summary as key=value lines")
+	symmetricClothoids    = flag.Bool("symmetric-clothoids", false, "check that the clothoids around a radius have equal lengths")
+	symmetryTolerance     = flag.Float64("symmetry-tolerance", 0.1, "allowed length difference of the clothoids around a radius as a fraction of the longer one")
+	showDirection         = flag.Bool("direction", false, "show the turn direction of radii and clothoids, positive radii turn right")
+	maxVp                 = flag.Int("max-vp", MaxVp, "highest vp to design for")
+	maxVpDiff             = flag.Int("max-vp-diff", MaxVpDiff, "largest allowed vp difference between adjacent elements")
+	headerParams          = flag.Bool("header-params", false, "read analysis parameters like max-vp from name=value cells in the header rows, flags on the command line take precedence")
+	requireTangentEnds    = flag.Bool("require-tangent-ends", false, "report an error if the alignment does not start and end with a straight")
+	printConfig           = flag.Bool("print-config", false, "print the effective flags after the config file and the header and exit")
+	lengthScale           = flag.Float64("length-scale", 1, "factor converting the input lengths and radii to m")
+	inputUnit             = flag.String("input-unit", "", "unit of the input lengths and radii (m, cm or ft), instead of -length-scale")
+	inflectionTolerance   = flag.Float64("inflection-tolerance", 0.1, "allowed relative difference of the parameters A of clothoids meeting at an inflection")
+	explainErrors         = flag.Bool("explain-errors", false, "explain why each flagged element is flagged")
+	junitOut              = flag.String("junit", "", "write a junit xml report with one test case per element to this file")
+	lengthEpsilon         = flag.Float64("length-epsilon", 0, "lengths within this many m of a limit pass, e.g. 0.005 for lengths rounded to cm (0 to disable)")
 )
 
-func stringifyErrors(e Flag) (result string) {
-	errorStrings := make([]string, 0, 2)
-	if e&EVpDiff != 0 {
-		errorStrings = append(errorStrings, "VpDiff")
+func (t *vpTable) String() string {
+	if t == nil {
+		return ""
 	}
-	if e&EMinLength != 0 {
-		errorStrings = append(errorStrings, "MinLength")
+	pairs := make([]string, 0, len(*t))
+	for _, vp := range sortedKeys(*t) {
+		pairs = append(pairs, fmt.Sprintf("%v=%v", vp, (*t)[vp]))
 	}
-	result = strings.Join(errorStrings, ", ")
-	return
+	return strings.Join(pairs, ",")
 }
 
-func stringifyType(t ElementType) (result string) {
-	result, ok := typeStringifications[t]
-	if !ok {
-		log.Fatalf("unknown type (%v)", t)
+func (t *vpTable) Set(s string) error {
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("missing = in %v", pair)
+		}
+		vp, err := strconv.Atoi(strings.TrimSpace(k))
+		if err != nil {
+			return err
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return err
+		}
+		(*t)[vp] = value
 	}
-	return
+	return nil
 }
 
-func printFloat(f float64) (result string) {
-	if f != 0 {
-		result = fmt.Sprintf("%.2f", f)
-	}
-	return
+func stringifyErrors(e Flag) string {
+	return stringifyFlags(e, SeverityError)
 }
 
-func createTable(elements []*Element) (result [][]string) {
-	result = append(result, []string{
-		"ID",
-		"Type",
-		"Length",
-		"Radius",
-		"Vp",
-		"MinLength",
-		"AMin",
-		"AMax",
-		"Errors"})
-	for _, e := range elements {
-		result = append(result, []string{
-			strconv.Itoa(e.ID),
-			stringifyType(e.Type),
-			printFloat(e.Length),
-			printFloat(e.Radius),
-			strconv.Itoa(e.Vp),
-			printFloat(e.MinLength),
-			printFloat(e.AMin),
-			printFloat(e.AMax),
-			stringifyErrors(e.Errors),
-		})
-	}
-	return
+func stringifyWarnings(e Flag) string {
+	return stringifyFlags(e, SeverityWarning)
 }
 
-func printTable(table [][]string) {
-	out := tablewriter.NewWriter(os.Stdout)
-	out.SetHeader(table[0])
-	for _, e := range table[1:] {
-		out.Append(e)
-	}
-	out.Render()
+func stringifyFlags(e Flag, severity Severity) string {
+	return strings.Join(flagNames(e, severity), ", ")
 }
 
-func writeCSV(table [][]string) {
-	f, err := os.Create(*exportCSV)
-	if err != nil {
-		log.Fatalf("failed writing data: %v", err)
+// flagNames returns the names of all set flags of the given severity
+func flagNames(e Flag, severity Severity) []string {
+	names := make([]string, 0, len(flagInfos))
+	for _, info := range flagInfos {
+		if e&info.flag != 0 && info.severity == severity {
+			names = append(names, info.name)
+		}
 	}
-	defer f.Close()
-
-	w := csv.NewWriter(f)
-	w.WriteAll(table)
-	w.Flush()
+	return names
 }
 
-func readElement(row []string) *Element {
-	result := new(Element)
-	var err error
-
-	result.ID, err = strconv.Atoi(row[0])
-	if err != nil {
-		log.Fatalf("couldn't convert %v to int %v", row[0], err)
+// parseFlagNames returns the flags named in the comma separated list s
+func parseFlagNames(s string) (result Flag, err error) {
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, info := range flagInfos {
+			if strings.EqualFold(info.name, name) {
+				result |= info.flag
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown flag %v", name)
+		}
 	}
+	return
+}
 
-	result.Type = determineElementType(row[1])
-
-	result.Length, err = strconv.ParseFloat(row[3], 64)
-	if err != nil {
-		log.Fatalf("couldn't convert %v to float %v", row[3], err)
+// severityFlags returns all flags of the given severity
+func severityFlags(severity Severity) (result Flag) {
+	for _, info := range flagInfos {
+		if info.severity == severity {
+			result |= info.flag
+		}
 	}
+	return
+}
 
-	if len(row[6]) > 0 && result.Type == Radius {
-		result.Radius, err = strconv.ParseFloat(row[6], 64)
-		if err != nil {
-			log.Fatalf("couldn't convert %v to float %v",
-				row[6],
-				err)
+// report sets flag f on the element and records it as a diagnostic with
+// the actual value and the limit it violates. Checks without values pass 0
+// for both. It allocates, so checks must only call it for findings.
+func (e *Element) report(f Flag, actual, limit float64) {
+	d := Diagnostic{Actual: actual, Limit: limit, flag: f}
+	for _, info := range flagInfos {
+		if info.flag == f {
+			d.Severity, d.Code, d.Message = info.severity, info.code, info.name
 		}
 	}
-
-	return result
+	if actual != 0 || limit != 0 {
+		d.Message = fmt.Sprintf("%v: %.2f, limit %.2f", d.Message, actual, limit)
+	}
+	e.Errors |= f
+	e.Diagnostics = append(e.Diagnostics, d)
 }
 
-func determineElementType(s string) (result ElementType) {
-	result, ok := typeTranslations[s]
-	if !ok {
-		log.Fatalf("unknown type: %v", s)
+// suppress removes the flags f and their diagnostics from the element
+func (e *Element) suppress(f Flag) {
+	e.Errors &^= f
+	kept := e.Diagnostics[:0]
+	for _, d := range e.Diagnostics {
+		if d.flag&f == 0 {
+			kept = append(kept, d)
+		}
 	}
-	return
+	e.Diagnostics = kept
 }
 
-func determineRadiusVp(radius float64) (vp int) {
-	radius = math.Abs(radius)
-	if radius <= 30 {
-		vp = 40
-	} else if radius <= 40 {
-		vp = 45
-	} else if radius <= 50 {
-		vp = 50
-	} else if radius <= 60 {
-		vp = 55
-	} else if radius <= 80 {
-		vp = 60
-	} else if radius <= 100 {
-		vp = 65
-	} else if radius <= 130 {
-		vp = 70
-	} else if radius <= 160 {
-		vp = 75
-	} else if radius <= 200 {
-		vp = 80
-	} else if radius <= 250 {
-		vp = 85
-	} else if radius <= 300 {
-		vp = 90
-	} else if radius <= 350 {
-		vp = 95
-	} else if radius <= 430 {
-		vp = 100
-	} else if radius <= 530 {
-		vp = 110
-	} else if radius <= 670 {
-		vp = 120
-	} else {
-		vp = 130
+// diagnosticFlags returns the flags of the diagnostics
+func diagnosticFlags(diags []Diagnostic) (result Flag) {
+	for _, d := range diags {
+		result |= d.flag
 	}
 	return
 }
 
-func determineStraightVp(radiusVp int, length float64) (vp int) {
-	found := false
-	vpAddition := radiusVp % 10
-	vp = radiusVp - vpAddition
-	vps, ok := straightVps[vp]
-	if !ok {
-		log.Fatalf("vp not found (%v)", vp)
+// findings collects and logs the diagnostics of a run which aren't tied to
+// a single element
+type findings struct {
+	logger      *slog.Logger
+	diagnostics []Diagnostic
+}
+
+// warnf records and logs a warning
+func (f *findings) warnf(format string, v ...interface{}) {
+	message := fmt.Sprintf(format, v...)
+	f.diagnostics = append(f.diagnostics, Diagnostic{Severity: SeverityWarning, Message: message})
+	f.logger.Warn(message)
+}
+
+// errorf records and logs an error
+func (f *findings) errorf(format string, v ...interface{}) {
+	message := fmt.Sprintf(format, v...)
+	f.diagnostics = append(f.diagnostics, Diagnostic{Severity: SeverityError, Message: message})
+	f.logger.Error(message)
+}
+
+// newFindings returns findings logged to logger. A nil logger discards
+// them.
+func newFindings(logger *slog.Logger) *findings {
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
 	}
-	for i, minLength := range vps {
-		if length <= minLength {
-			vp += 10*i + vpAddition
-			found = true
-			break
+	return &findings{logger: logger}
+}
+
+func stringifyCodes(e Flag) string {
+	return strings.Join(flagCodes(e), ", ")
+}
+
+// flagCodes returns the codes of all set flags
+func flagCodes(e Flag) []string {
+	codes := make([]string, 0, len(flagInfos))
+	for _, info := range flagInfos {
+		if e&info.flag != 0 {
+			codes = append(codes, info.code)
 		}
 	}
-	if !found {
-		vp = MaxStraightVp
-	}
-	return
+	return codes
 }
 
-func determineMinClothoidLength(radiusVp int) (length float64) {
-	length, ok := clothoidMinLengths[radiusVp]
+func stringifyType(t ElementType) string {
+	result, ok := typeStringifications[t]
 	if !ok {
-		log.Fatalf("no clothoid length found for vp (%v)", radiusVp)
+		return fmt.Sprintf("ElementType(%d)", int(t))
 	}
-	return
+	return result
 }
 
-func abs(a int) int {
-	if a < 0 {
-		return -a
-	}
-	return a
+func (t ElementType) String() string {
+	return stringifyType(t)
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
+// elementRef identifies an element in messages by its id, with
+// -show-index also by its position
+func elementRef(e *Element) string {
+	if *showIndex {
+		return fmt.Sprintf("%v (index %v)", e.ID, e.Index)
 	}
-	return b
+	return strconv.Itoa(e.ID)
 }
 
-func max(a, b int) int {
-	if a > b {
-		return a
+// printDirection formats the turn sense of radii and clothoids as R or L
+func printDirection(e *Element) string {
+	switch {
+	case e.Type == Straight:
+		return ""
+	case e.Turn > 0:
+		return "R"
+	case e.Turn < 0:
+		return "L"
 	}
-	return b
+	return "—"
 }
 
-func getNextRadius(elements []*Element, pos int) (result *Element) {
-	result, _ = getDirectedNextRadius(elements, pos, 1)
+// printID formats an id, leaving 0 empty
+func printID(id int) (result string) {
+	if id != 0 {
+		result = strconv.Itoa(id)
+	}
 	return
 }
 
-func getPreviousRadius(elements []*Element, pos int) (result *Element) {
-	result, _ = getDirectedNextRadius(elements, pos, -1)
+func printFloat(f float64) (result string) {
+	if f != 0 {
+		result = fmt.Sprintf("%.2f", f)
+	}
 	return
 }
 
-func getNearestRadius(elements []*Element, pos int) (result *Element) {
-	previous, previousDistance := getDirectedNextRadius(elements, pos, -1)
-	next, nextDistance := getDirectedNextRadius(elements, pos, 1)
-	if previous == nil && next == nil {
-		log.Fatalf("could not find nearest radius")
-	} else if previous != nil && next == nil {
-		result = previous
-	} else if previous == nil && next != nil {
-		result = next
-	} else if previousDistance < nextDistance {
-		result = previous
-	} else {
-		result = next
+// printTime formats the time in seconds needed to traverse the element
+func printTime(e *Element) string {
+	if e.Vp == 0 {
+		return "n/a"
 	}
-	return
+	return fmt.Sprintf("%.1f", traversalTime(e))
 }
 
-func getDirectedNextRadius(elements []*Element, pos, increment int) (result *Element, distance int) {
-	for i := pos + increment; i > 0 && i < len(elements); i += increment {
-		distance++
-		if elements[i].Type == Radius {
-			result = elements[i]
-			break
-		}
+// rawFloat formats f with full precision, leaving 0 empty like printFloat
+func rawFloat(f float64) (result string) {
+	if f != 0 {
+		result = strconv.FormatFloat(f, 'g', -1, 64)
 	}
 	return
 }
 
-func drivingSecondLength(vp, seconds int) float64 {
-	return float64(vp) / 3.6 * float64(seconds)
+// createTable builds the rows for the given elements. Elements in context
+// are marked as context rows.
+func createTable(elements []*Element, context map[*Element]bool) [][]string {
+	return createFormattedTable(elements, context, printFloat)
 }
 
-func main() {
-	flag.Parse()
-
-	file, err := os.Open(flag.Args()[0])
-	if err != nil {
-		log.Fatalf("failed opening the file: %v", err)
+// createFormattedTable is createTable with floats formatted by format. The
+// A and Label columns are shown if their column is set or, with
+// -header-map, if any element has a value.
+func createFormattedTable(elements []*Element, context map[*Element]bool, format func(float64) string) (result [][]string) {
+	showA, showLabel := *colA >= 0, *colLabel >= 0
+	for _, e := range elements {
+		showA = showA || e.HasA
+		showLabel = showLabel || e.Label != ""
 	}
-	defer file.Close()
-
-	reader := csv.NewReader(file)
-	data, err := reader.ReadAll()
-	if err != nil {
-		log.Fatalf("Failed reading data: %v", err)
+	header := []string{
+		"ID",
+		"Type",
+		"Length",
+		"Radius",
+		"Deflection",
+		"Vp",
+		"MinLength",
+		"MaxLength",
+		"AMin",
+		"AMax",
+		"Cant",
+		"Grade",
+		"Time",
+		"Errors",
+		"Warnings"}
+	if *showCodes {
+		header = append(header, "Codes")
 	}
-
-	var elements []*Element
-
-	for _, row := range data[3 : len(data)-1] {
-		elements = append(elements, readElement(row))
+	if *renumber {
+		header = append(header, "OrigID")
 	}
-
-	// determine radius vp and length of clothoids
+	if showA {
+		header = append(header, "A")
+	}
+	if *wheelbase > 0 {
+		header = append(header, "Widening")
+	}
+	if showLabel {
+		header = append(header, "Label")
+	}
+	if *showNeighbors {
+		header = append(header, "PrevRadiusId", "NextRadiusId")
+	}
+	if *showDirection {
+		header = append(header, "Direction")
+	}
+	if *showIndex {
+		header = append([]string{"Index"}, header...)
+	}
+	result = append(result, header)
 	for _, e := range elements {
-		if e.Type == Radius {
-			e.Vp = min(MaxVp, determineRadiusVp(e.Radius))
-
-			lClothMin := determineMinClothoidLength(e.Vp)
-			e.AMin = math.Sqrt(math.Abs(e.Radius) * lClothMin)
-			e.AMax = math.Sqrt(math.Abs(e.Radius) * lClothMin * 2)
+		flags := diagnosticFlags(e.Diagnostics)
+		errors := stringifyErrors(flags)
+		if context[e] {
+			errors = "(context)"
+		}
+		row := []string{
+			strconv.Itoa(e.ID),
+			stringifyType(e.Type),
+			format(e.Length),
+			format(e.Radius),
+			format(deflection(e)),
+			strconv.Itoa(e.Vp),
+			format(e.MinLength),
+			format(e.MaxLength),
+			format(e.AMin),
+			format(e.AMax),
+			format(e.Cant),
+			format(e.Grade),
+			printTime(e),
+			errors,
+			stringifyWarnings(flags),
+		}
+		if *showCodes {
+			row = append(row, stringifyCodes(flags))
+		}
+		if *renumber {
+			row = append(row, strconv.Itoa(e.OrigID))
+		}
+		if showA {
+			a := ""
+			if e.HasA {
+				a = format(e.AActual)
+			}
+			row = append(row, a)
+		}
+		if *wheelbase > 0 {
+			row = append(row, format(e.Widening))
+		}
+		if showLabel {
+			row = append(row, e.Label)
+		}
+		if *showNeighbors {
+			row = append(row, printID(e.PrevRadiusID), printID(e.NextRadiusID))
+		}
+		if *showDirection {
+			row = append(row, printDirection(e))
+		}
+		if *showIndex {
+			row = append([]string{strconv.Itoa(e.Index)}, row...)
 		}
+		result = append(result, row)
 	}
+	return
+}
 
-	// determine straigth vp
-	for i, e := range elements {
-		if e.Type == Straight {
-			radiusVp := 0
-			if r := getPreviousRadius(elements, i); r != nil {
-				radiusVp = max(r.Vp, radiusVp)
-			}
-			if r := getNextRadius(elements, i); r != nil {
-				radiusVp = max(r.Vp, radiusVp)
+// totalsRow returns a row summarizing all elements for a table with the
+// given header. It holds the number of elements, the total length and the
+// mean vp, the other columns are left blank.
+func totalsRow(header []string, summary Summary) []string {
+	row := make([]string, len(header))
+	for i, column := range header {
+		switch column {
+		case "ID":
+			row[i] = "TOTAL"
+		case "Type":
+			row[i] = fmt.Sprintf("%v elements", summary.Elements)
+		case "Length":
+			row[i] = printFloat(summary.TotalLength)
+		case "Vp":
+			if summary.HasMeanVp {
+				row[i] = printFloat(summary.MeanVp)
 			}
-			e.Vp = determineStraightVp(radiusVp, e.Length)
 		}
 	}
+	return row
+}
 
-	// determine clothoid vp
-	for i, e := range elements {
-		if e.Type == Clothoid {
-			radius := getNearestRadius(elements, i)
-			e.Vp = radius.Vp
-		}
+// printTable renders the table to stdout. If maxRows is positive, only
+// that many element rows are rendered followed by a note about the
+// omitted ones. A totals row is always rendered. A table without element
+// rows, which only happens if no element is flagged, is replaced by a note.
+func printTable(table [][]string, maxRows int) {
+	var totals [][]string
+	rows := table
+	if *showTotals {
+		totals = rows[len(rows)-1:]
+		rows = rows[:len(rows)-1]
+	}
+	if len(rows) == 1 {
+		fmt.Println("No elements to display (0 errors)")
+		return
+	}
+	omitted := 0
+	if maxRows > 0 && len(rows)-1 > maxRows {
+		omitted = len(rows) - 1 - maxRows
+		rows = rows[:maxRows+1]
+	}
+	renderTable(os.Stdout, append(rows[:len(rows):len(rows)], totals...))
+	if omitted > 0 {
+		fmt.Printf("... (%v more)\n", omitted)
+	}
+}
+
+func renderTable(w io.Writer, table [][]string) {
+	out := tablewriter.NewWriter(w)
+	// keep the headers as given, they name the columns like the csv
+	out.SetAutoFormatHeader(false)
+	out.SetHeader(table[0])
+	for _, row := range table[1:] {
+		e := row
+		if *maxColWidth > 0 {
+			e = make([]string, len(row))
+			for i, c := range row {
+				e[i] = truncateCell(c, *maxColWidth)
+			}
+		}
+		if *color {
+			if c := rowColor(table[0], row); c != tablewriter.Normal {
+				colors := make([]tablewriter.Colors, len(e))
+				for i := range colors {
+					colors[i] = tablewriter.Colors{c}
+				}
+				out.Rich(e, colors)
+				continue
+			}
+		}
+		out.Append(e)
+	}
+	out.Render()
+}
+
+// truncateCell shortens s to width characters, the last being an ellipsis
+func truncateCell(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+	return string(runes[:width-1]) + "…"
+}
+
+// rowColor returns the color for a table row by the severity of its
+// flags. Warnings and a MinLength error less than -color-gross percent
+// below the minimum are yellow, all other errors red.
+func rowColor(header, row []string) int {
+	column := func(name string) string {
+		for i, c := range header {
+			if c == name && i < len(row) {
+				return row[i]
+			}
+		}
+		return ""
+	}
+	errors := column("Errors")
+	switch {
+	case errors == "MinLength":
+		length, _ := strconv.ParseFloat(column("Length"), 64)
+		minLength, _ := strconv.ParseFloat(column("MinLength"), 64)
+		if minLength > 0 && (minLength-length)/minLength*100 < *colorGross {
+			return tablewriter.FgYellowColor
+		}
+		return tablewriter.FgRedColor
+	case errors != "" && errors != "(context)":
+		return tablewriter.FgRedColor
+	case column("Warnings") != "":
+		return tablewriter.FgYellowColor
+	}
+	return tablewriter.Normal
+}
+
+func writeCSV(table [][]string) {
+	writeFile(*exportCSV, func(w io.Writer) {
+		writeCSVTo(w, table)
+	})
+}
+
+// writeProfile writes the vp along the alignment as station,vp rows. With
+// a step of 0 there is one row at the start of each element, otherwise the
+// alignment is sampled every step meters. The last row is at the end of
+// the alignment.
+func writeProfile(w io.Writer, elements []*Element, step float64) {
+	out := csv.NewWriter(w)
+	out.Write([]string{"station", "vp"})
+	write := func(station float64, vp int) {
+		out.Write([]string{
+			strconv.FormatFloat(station, 'f', 2, 64),
+			strconv.Itoa(vp),
+		})
+	}
+
+	var start float64
+	next := 0.0 // next sampled station
+	for _, e := range elements {
+		end := start + e.Length
+		if step <= 0 {
+			write(start, e.Vp)
+		} else {
+			for ; next < end; next += step {
+				write(next, e.Vp)
+			}
+		}
+		start = end
+	}
+	if len(elements) > 0 {
+		write(start, elements[len(elements)-1].Vp)
+	}
+
+	out.Flush()
+	if err := out.Error(); err != nil {
+		log.Fatalf("failed writing data: %v", err)
+	}
+}
+
+// writeFile creates the file at path and lets write fill it
+func writeFile(path string, write func(w io.Writer)) {
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatalf("failed writing data: %v", err)
+	}
+	defer f.Close()
+
+	write(f)
+}
+
+func writeCSVTo(w io.Writer, table [][]string) {
+	out := csv.NewWriter(w)
+	if err := out.WriteAll(table); err != nil {
+		log.Fatalf("failed writing data: %v", err)
+	}
+}
+
+// writeTSV writes the table with tab separated, unquoted fields. Tabs and
+// line breaks within fields are replaced by spaces.
+func writeTSV(w io.Writer, table [][]string) {
+	clean := strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+	for _, row := range table {
+		fields := make([]string, len(row))
+		for i, field := range row {
+			fields[i] = clean.Replace(field)
+		}
+		fmt.Fprintln(w, strings.Join(fields, "\t"))
+	}
+}
+
+// readElement parses an element row with the given columns
+func readElement(row []string, cols Columns) (*Element, error) {
+	result := new(Element)
+	var err error
+
+	id := cell(row, cols.ID)
+	result.ID, err = strconv.Atoi(id)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't convert %v to int %v", id, err)
+	}
+
+	result.Type, err = determineElementType(cell(row, cols.Type))
+	if err != nil {
+		return nil, err
+	}
+
+	length := cell(row, cols.Length)
+	result.Length, err = strconv.ParseFloat(length, 64)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't convert %v to float %v", length, err)
+	}
+	if result.Length <= 0 {
+		return nil, fmt.Errorf("non-positive length %v of element %v",
+			result.Length,
+			result.ID)
+	}
+
+	radius := cell(row, cols.Radius)
+	if len(radius) > 0 && result.Type == Radius {
+		result.Radius, err = strconv.ParseFloat(radius, 64)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't convert %v to float %v",
+				radius,
+				err)
+		}
+	}
+
+	x, okX, err := readFloatColumn(row, cols.X)
+	if err != nil {
+		return nil, err
+	}
+	y, okY, err := readFloatColumn(row, cols.Y)
+	if err != nil {
+		return nil, err
+	}
+	if okX && okY {
+		result.X, result.Y, result.HasCoords = x, y, true
+	}
+
+	result.Grade, result.HasGrade, err = readFloatColumn(row, cols.Grade)
+	if err != nil {
+		return nil, err
+	}
+	result.Elevation, result.HasElevation, err = readFloatColumn(row, cols.Elevation)
+	if err != nil {
+		return nil, err
+	}
+	result.DeclaredStation, result.HasDeclaredStation, err = readFloatColumn(row, cols.Station)
+	if err != nil {
+		return nil, err
+	}
+	if cols.Label >= 0 {
+		result.Label = cell(row, cols.Label)
+	}
+	direction := cell(row, cols.Direction)
+	switch strings.ToLower(strings.TrimSpace(direction)) {
+	case "":
+	case "r", "right", "rechts":
+		result.Turn = 1
+	case "l", "left", "links":
+		result.Turn = -1
+	default:
+		return nil, fmt.Errorf("unknown direction %v of element %v", direction, result.ID)
+	}
+	if result.Type == Clothoid {
+		result.AActual, result.HasA, err = readFloatColumn(row, cols.A)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// decodeInput converts the input from inputEncoding to UTF-8 and strips a
+// leading byte order mark
+func decodeInput(r io.Reader) io.Reader {
+	if *inputEncoding != "" {
+		enc, err := htmlindex.Get(*inputEncoding)
+		if err != nil {
+			log.Fatalf("unknown encoding %v: %v", *inputEncoding, err)
+		}
+		r = enc.NewDecoder().Reader(r)
+	}
+	br := bufio.NewReader(r)
+	if bom, err := br.Peek(3); err == nil && string(bom) == "\ufeff" {
+		br.Discard(3)
+	}
+	return br
+}
+
+// Columns holds the column index of each element field. Optional fields
+// are disabled with -1.
+type Columns struct {
+	ID        int
+	Type      int
+	Length    int
+	Radius    int
+	X         int
+	Y         int
+	Grade     int
+	Elevation int
+	Station   int
+	A         int
+	Label     int
+	Direction int
+}
+
+// Options controls how Parse splits the input into header, element and
+// footer rows and where it finds the fields of the element rows.
+type Options struct {
+	HeaderRows    int
+	FooterRows    int
+	AutoFooter    bool
+	StrictColumns bool
+	Columns       Columns
+	// HeaderMap is the header row whose column names override Columns
+	HeaderMap int
+	// Header is called with every header row, e.g. to read metadata. An
+	// error stops the parsing.
+	Header func(line int, row []string) error
+
+	// CheckTotal compares the summed length against the total in the
+	// first footer row, allowing a difference of TotalTolerance
+	CheckTotal     bool
+	TotalTolerance float64
+
+	// LengthScale converts the lengths and radii of the input to m, the
+	// total check happens before in the input's unit
+	LengthScale float64
+}
+
+// unitScales holds the factors converting the units of -input-unit to m
+var unitScales = map[string]float64{
+	"m":  1,
+	"cm": 0.01,
+	"ft": 0.3048,
+}
+
+// lengthScaleFromFlags returns the factor of -input-unit or -length-scale
+func lengthScaleFromFlags() float64 {
+	if *inputUnit == "" {
+		if *lengthScale <= 0 {
+			log.Fatalf("-length-scale must be positive (%v)", *lengthScale)
+		}
+		return *lengthScale
+	}
+	if *lengthScale != 1 {
+		log.Fatalf("-input-unit and -length-scale are exclusive")
+	}
+	scale, ok := unitScales[strings.ToLower(*inputUnit)]
+	if !ok {
+		log.Fatalf("unknown input unit %v, use m, cm or ft", *inputUnit)
+	}
+	return scale
+}
+
+// optionsFromFlags returns the Options set on the command line
+func optionsFromFlags() Options {
+	return Options{
+		HeaderRows:    *headerRows,
+		FooterRows:    *footerRows,
+		AutoFooter:    *autoFooter,
+		StrictColumns: *strictColumns,
+		Columns: Columns{
+			ID:        *colID,
+			Type:      *colType,
+			Length:    *colLength,
+			Radius:    *colRadius,
+			X:         *colX,
+			Y:         *colY,
+			Grade:     *colGrade,
+			Elevation: *colElevation,
+			Station:   *colStation,
+			A:         *colA,
+			Label:     *colLabel,
+			Direction: *colDirection,
+		},
+		HeaderMap:      *headerMap,
+		CheckTotal:     *checkTotal,
+		TotalTolerance: *totalTolerance,
+		LengthScale:    lengthScaleFromFlags(),
+	}
+}
+
+// scaleLengths converts all lengths of e by factor
+func scaleLengths(e *Element, factor float64) {
+	e.Length *= factor
+	e.Radius *= factor
+	e.AActual *= factor
+	e.DeclaredStation *= factor
+	e.X *= factor
+	e.Y *= factor
+	e.Elevation *= factor
+}
+
+// Parse reads the elements row by row, skipping the header rows. The
+// footer rows aren't parsed as elements. With StrictColumns every row after
+// the header must have as many columns as the last header row. Rows which
+// can't be parsed are skipped and reported as error diagnostics, a failure
+// to read the input at all is returned as err.
+func Parse(r io.Reader, opts Options) (elements []*Element, diags []Diagnostic, err error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	cols := opts.Columns
+	add := func(line int, row []string) {
+		e, err := readElement(row, cols)
+		if err != nil {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityError,
+				Message:  fmt.Sprintf("line %v: %v", line, err)})
+		} else {
+			elements = append(elements, e)
+		}
+	}
+	// with -auto-footer, trailing holds the rows without numeric id since
+	// the last element. They are the footer unless another element follows.
+	var pending, trailing [][]string
+	for line := 1; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) && parseErr.Err == csv.ErrFieldCount {
+				return nil, nil, fmt.Errorf("line %v has %v columns, but the header has %v",
+					parseErr.Line,
+					len(row),
+					reader.FieldsPerRecord)
+			}
+			return nil, nil, fmt.Errorf("failed reading data: %v", err)
+		}
+		if line <= opts.HeaderRows {
+			if line == opts.HeaderRows && opts.StrictColumns {
+				reader.FieldsPerRecord = len(row)
+			}
+			if line == opts.HeaderMap {
+				mapColumns(row, &cols)
+			}
+			if opts.Header != nil {
+				if err := opts.Header(line, row); err != nil {
+					return nil, nil, fmt.Errorf("line %v: %v", line, err)
+				}
+			}
+			continue
+		}
+		if opts.AutoFooter {
+			if _, err := strconv.Atoi(cell(row, cols.ID)); err != nil {
+				trailing = append(trailing, row)
+				continue
+			}
+			for i, t := range trailing {
+				add(line-len(trailing)+i, t)
+			}
+			trailing = nil
+			add(line, row)
+			continue
+		}
+		pending = append(pending, row)
+		if len(pending) <= opts.FooterRows {
+			continue
+		}
+		add(line-opts.FooterRows, pending[0])
+		// shift instead of reslicing, which would reallocate on every row
+		pending = append(pending[:0], pending[1:]...)
+	}
+	if opts.AutoFooter {
+		pending = trailing
+	}
+	if opts.CheckTotal && len(elements) > 0 {
+		var footer []string
+		if len(pending) > 0 {
+			footer = pending[0]
+		}
+		if message := checkTotalLength(cell(footer, cols.Length), elements, opts.TotalTolerance); message != "" {
+			diags = append(diags, Diagnostic{Severity: SeverityWarning, Message: message})
+		}
+	}
+	if opts.LengthScale != 0 && opts.LengthScale != 1 {
+		for _, e := range elements {
+			scaleLengths(e, opts.LengthScale)
+		}
+	}
+	return
+}
+
+// cell returns the content of column col or an empty string if the row
+// has no such column
+func cell(row []string, col int) string {
+	if col < 0 || col >= len(row) {
+		return ""
+	}
+	return row[col]
+}
+
+// mapColumns sets the columns from the names in a header row. Columns whose
+// name isn't found keep their index.
+func mapColumns(header []string, cols *Columns) {
+	for i, name := range header {
+		if col, ok := headerAliases[strings.ToLower(strings.TrimSpace(name))]; ok {
+			*col(cols) = i
+		}
+	}
+}
+
+// readFloatColumn parses the float in column col of row. ok is false if col
+// is negative or the cell is empty.
+func readFloatColumn(row []string, col int) (result float64, ok bool, err error) {
+	if col < 0 || col >= len(row) || row[col] == "" {
+		return
+	}
+	result, err = strconv.ParseFloat(row[col], 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("couldn't convert %v to float %v", row[col], err)
+	}
+	return result, true, nil
+}
+
+// checkDegenerate warns about alignments too small for a meaningful
+// analysis: fewer than -min-elements elements or no radius at all
+func checkDegenerate(elements []*Element, found *findings) {
+	if *minElements > 0 && len(elements) < *minElements {
+		found.warnf("only %v elements, the analysis needs at least %v to be meaningful",
+			len(elements),
+			*minElements)
+	}
+	for _, e := range elements {
+		if e.Type == Radius {
+			return
+		}
+	}
+	found.warnf("the alignment has no radius, all vps are the maximum vp")
+}
+
+// checkTangentEnds reports an error if the first or the last element isn't
+// a straight
+func checkTangentEnds(elements []*Element, found *findings) {
+	if len(elements) == 0 {
+		return
+	}
+	first, last := elements[0], elements[len(elements)-1]
+	if first.Type != Straight {
+		found.errorf("the alignment starts with %v %v instead of a straight",
+			first.Type,
+			first.ID)
+	}
+	if last.Type != Straight {
+		found.errorf("the alignment ends with %v %v instead of a straight",
+			last.Type,
+			last.ID)
+	}
+}
+
+// checkTotalLength compares the sum of all element lengths against the
+// total length declared in the footer row. It returns a message if they
+// differ by more than tolerance or if there is no usable total.
+func checkTotalLength(total string, elements []*Element, tolerance float64) string {
+	if total == "" {
+		return "footer row contains no total length"
+	}
+	declared, err := strconv.ParseFloat(total, 64)
+	if err != nil {
+		return fmt.Sprintf("couldn't convert total length %v to float %v",
+			total,
+			err)
+	}
+
+	var sum float64
+	for _, e := range elements {
+		sum += e.Length
+	}
+	if math.Abs(sum-declared) > tolerance {
+		return fmt.Sprintf("summed length %.2f differs from declared total %.2f",
+			sum,
+			declared)
+	}
+	return ""
+}
+
+// mergeable reports whether b continues a without any change in geometry.
+// Clothoids are never mergeable since two adjacent clothoids form a
+// transition of their own.
+func mergeable(a, b *Element) bool {
+	return a.Type == b.Type && a.Type != Clothoid && a.Radius == b.Radius
+}
+
+// checkMergeable flags elements which could be merged with their
+// predecessor
+func checkMergeable(elements []*Element) {
+	for i := 1; i < len(elements); i++ {
+		if mergeable(elements[i-1], elements[i]) {
+			elements[i].report(EMergeable, 0, 0)
+		}
+	}
+}
+
+// mergeElements merges mergeable elements into their predecessor
+func mergeElements(elements []*Element) (result []*Element) {
+	for _, e := range elements {
+		if len(result) > 0 && mergeable(result[len(result)-1], e) {
+			result[len(result)-1].Length += e.Length
+			continue
+		}
+		result = append(result, e)
+	}
+	return
+}
+
+// computeStations sets the start station of each element from the lengths
+// of the preceding elements. The alignment starts at the declared station
+// of the first element, if any.
+func computeStations(elements []*Element) {
+	var station float64
+	if len(elements) > 0 && elements[0].HasDeclaredStation {
+		station = elements[0].DeclaredStation
+	}
+	for _, e := range elements {
+		e.Station = station
+		station += e.Length
+	}
+}
+
+// checkStations flags the first element whose declared station differs
+// from the computed one, which points to a missing or reordered element
+func checkStations(elements []*Element) {
+	for _, e := range elements {
+		if e.HasDeclaredStation &&
+			math.Abs(e.DeclaredStation-e.Station) > *stationTolerance {
+			e.report(EStation, e.DeclaredStation, e.Station)
+			return
+		}
+	}
+}
+
+// renumberElements assigns sequential ids starting at base and keeps the
+// original ids
+func renumberElements(elements []*Element, base int) {
+	for i, e := range elements {
+		e.OrigID = e.ID
+		e.ID = base + i
+	}
+}
+
+// circumRadius returns the radius of the circle through three points.
+// Clockwise (right) turns are positive and counterclockwise (left) turns
+// are negative. 0 is returned for collinear points.
+func circumRadius(x1, y1, x2, y2, x3, y3 float64) float64 {
+	cross := (x2-x1)*(y3-y1) - (y2-y1)*(x3-x1)
+	if cross == 0 {
+		return 0
+	}
+	a := math.Hypot(x2-x1, y2-y1)
+	b := math.Hypot(x3-x2, y3-y2)
+	c := math.Hypot(x3-x1, y3-y1)
+	radius := a * b * c / (2 * cross)
+	if math.Abs(radius) > MaxCoordRadius {
+		return 0
+	}
+	return -radius
+}
+
+// arcRadius returns the radius of a circular arc of the given length whose
+// end points are chord apart by solving chord = 2R·sin(length/2R). 0 is
+// returned for arcs too flat to tell from a straight.
+func arcRadius(chord, length float64) float64 {
+	ratio := chord / length
+	if ratio >= 1 {
+		return 0
+	}
+	// sin(x)/x falls from 1 to 0 for half the central angle x in (0, π)
+	low, high := 0.0, math.Pi
+	for range 64 {
+		x := (low + high) / 2
+		if math.Sin(x)/x > ratio {
+			low = x
+		} else {
+			high = x
+		}
+	}
+	radius := length / (low + high)
+	if radius > MaxCoordRadius {
+		return 0
+	}
+	return radius
+}
+
+// computeRadii sets the radius of each radius element from its length and
+// the chord between its start point and the start point of the next
+// element, which both lie on the arc. The turn sense is taken from the
+// start point of the previous element. Radius elements without a
+// computable radius are treated as straights.
+func computeRadii(elements []*Element, found *findings) {
+	for i, e := range elements {
+		if e.Type != Radius || i == 0 || i == len(elements)-1 {
+			continue
+		}
+		p, n := elements[i-1], elements[i+1]
+		if !p.HasCoords || !e.HasCoords || !n.HasCoords {
+			continue
+		}
+		turn := radiusTurn(circumRadius(p.X, p.Y, e.X, e.Y, n.X, n.Y))
+		e.Radius = float64(turn) * arcRadius(math.Hypot(n.X-e.X, n.Y-e.Y), e.Length)
+		if e.Radius == 0 {
+			found.warnf("radius %v has collinear coordinates, treating it as straight",
+				elementRef(e))
+			e.Type = Straight
+		}
+	}
+}
+
+// radiusTurn returns the turn sense of a signed radius
+func radiusTurn(radius float64) int {
+	switch {
+	case radius > 0:
+		return 1
+	case radius < 0:
+		return -1
+	}
+	return 0
+}
+
+// normalizeRadiusSigns signs the radii by their turn sense, right turns
+// positive and left turns negative. The sense is taken from the direction
+// column or else from the coordinates of the neighbors. Radii without a
+// known sense are left as they are.
+func normalizeRadiusSigns(elements []*Element, found *findings) {
+	for i, e := range elements {
+		if e.Type != Radius || e.Radius == 0 {
+			continue
+		}
+		turn := e.Turn
+		if turn == 0 && i > 0 && i < len(elements)-1 {
+			p, n := elements[i-1], elements[i+1]
+			if p.HasCoords && e.HasCoords && n.HasCoords {
+				turn = radiusTurn(circumRadius(p.X, p.Y, e.X, e.Y, n.X, n.Y))
+			}
+		}
+		if turn == 0 {
+			continue
+		}
+		if (e.Radius > 0) != (turn > 0) {
+			found.warnf("radius %v has the sign of the opposite direction, flipping it",
+				elementRef(e))
+			e.Radius = -e.Radius
+		}
+	}
+}
+
+// computeGrades sets the grade of each element from its start elevation and
+// the start elevation of the following element
+func computeGrades(elements []*Element) {
+	for i := 1; i < len(elements); i++ {
+		e, n := elements[i-1], elements[i]
+		if e.HasElevation && n.HasElevation {
+			e.Grade = (n.Elevation - e.Elevation) / e.Length * 100
+			e.HasGrade = true
+		}
+	}
+}
+
+func determineElementType(s string) (ElementType, error) {
+	result, ok := typeTranslations[s]
+	if !ok {
+		return result, fmt.Errorf("unknown type: %v", s)
+	}
+	return result, nil
+}
+
+func determineRadiusVp(radius float64) (vp int) {
+	radius = math.Abs(radius)
+	if radius <= 30 {
+		vp = 40
+	} else if radius <= 40 {
+		vp = 45
+	} else if radius <= 50 {
+		vp = 50
+	} else if radius <= 60 {
+		vp = 55
+	} else if radius <= 80 {
+		vp = 60
+	} else if radius <= 100 {
+		vp = 65
+	} else if radius <= 130 {
+		vp = 70
+	} else if radius <= 160 {
+		vp = 75
+	} else if radius <= 200 {
+		vp = 80
+	} else if radius <= 250 {
+		vp = 85
+	} else if radius <= 300 {
+		vp = 90
+	} else if radius <= 350 {
+		vp = 95
+	} else if radius <= 430 {
+		vp = 100
+	} else if radius <= 530 {
+		vp = 110
+	} else if radius <= 670 {
+		vp = 120
+	} else {
+		vp = 130
+	}
+	return
+}
+
+// inBucket reports whether a straight of the given length falls into the
+// straight vp bucket ending at limit. With the inclusive boundary policy a
+// length of exactly limit belongs to the bucket, with the exclusive policy
+// it belongs to the next (faster) one.
+func inBucket(length, limit float64) (bool, error) {
+	switch *bucketBoundary {
+	case "inclusive":
+		return length <= limit, nil
+	case "exclusive":
+		return length < limit, nil
+	}
+	return false, fmt.Errorf("unknown bucket boundary policy (%v)", *bucketBoundary)
+}
+
+// combineRadiusVps combines the vps of the radii before and after a
+// straight according to -straight-vp-mode. Either radius may be nil, a
+// single radius is taken as is. Averages are rounded to steps of 5 km/h
+// like the radius vps.
+func combineRadiusVps(previous, next *Element) (int, error) {
+	switch {
+	case previous == nil && next == nil:
+		return 0, nil
+	case previous == nil:
+		return next.Vp, nil
+	case next == nil:
+		return previous.Vp, nil
+	}
+	switch *straightVpMode {
+	case "max":
+		return max(previous.Vp, next.Vp), nil
+	case "min":
+		return min(previous.Vp, next.Vp), nil
+	case "avg":
+		return int(math.Round(float64(previous.Vp+next.Vp)/10)) * 5, nil
+	}
+	return 0, fmt.Errorf("unknown straight vp mode (%v)", *straightVpMode)
+}
+
+func determineStraightVp(radiusVp int, length float64) (vp int, err error) {
+	// without any radius nothing limits the vp, next to a radius at the
+	// maximum vp it can't get any higher
+	if radiusVp == 0 || radiusVp >= MaxStraightVp {
+		return MaxStraightVp, nil
+	}
+	found := false
+	vpAddition := radiusVp % 10
+	vp = radiusVp - vpAddition
+	vps, ok := straightVps[vp]
+	if !ok {
+		return 0, fmt.Errorf("vp not found (%v)", vp)
+	}
+	for i, minLength := range vps {
+		in, err := inBucket(length, minLength)
+		if err != nil {
+			return 0, err
+		}
+		if in {
+			vp += 10*i + vpAddition
+			found = true
+			break
+		}
+	}
+	if !found {
+		vp = MaxStraightVp
+	}
+	return
+}
+
+// determineMinClothoidLength returns the minimum clothoid length for
+// radiusVp. With -clothoid-clamp a missing vp takes the next larger entry,
+// which is the stricter one, and vps above the table take the largest.
+func determineMinClothoidLength(radiusVp int) (float64, error) {
+	if length, ok := clothoidMinLengths[radiusVp]; ok {
+		return length, nil
+	}
+	if !*clothoidClamp {
+		return 0, fmt.Errorf("no clothoid length found for vp (%v)", radiusVp)
+	}
+	vps := sortedKeys(clothoidMinLengths)
+	for _, vp := range vps {
+		if vp > radiusVp {
+			return clothoidMinLengths[vp], nil
+		}
+	}
+	return clothoidMinLengths[vps[len(vps)-1]], nil
+}
+
+func determineMaxGrade(vp int) (float64, error) {
+	grade, ok := maxGrades[vp]
+	if !ok {
+		return 0, fmt.Errorf("no maximum grade found for vp (%v)", vp)
+	}
+	return grade, nil
+}
+
+// determineMinSightRadius returns the smallest radius which keeps the
+// stopping sight distance s clear with the lateral clearance m:
+//
+//	radius = s² / (8 * m)
+func determineMinSightRadius(vp int) (float64, error) {
+	s, ok := sightDistances[vp]
+	if !ok {
+		return 0, fmt.Errorf("no stopping sight distance found for vp (%v)", vp)
+	}
+	return s * s / (8 * *sightOffset), nil
+}
+
+// abs returns the absolute value of a
+func abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+func getNextRadius(elements []*Element, pos int) (result *Element) {
+	result, _ = getDirectedNextRadius(elements, pos, 1)
+	return
+}
+
+func getPreviousRadius(elements []*Element, pos int) (result *Element) {
+	result, _ = getDirectedNextRadius(elements, pos, -1)
+	return
+}
+
+// getNearestRadius returns the radius closest to pos or nil if there is
+// no radius at all
+func getNearestRadius(elements []*Element, pos int) (result *Element) {
+	previous, previousDistance := getDirectedNextRadius(elements, pos, -1)
+	next, nextDistance := getDirectedNextRadius(elements, pos, 1)
+	if previous != nil && next == nil {
+		result = previous
+	} else if previous == nil && next != nil {
+		result = next
+	} else if previousDistance < nextDistance {
+		result = previous
+	} else {
+		result = next
+	}
+	return
+}
+
+// getClothoidRadius returns the radius a clothoid transitions to.
+//
+// With the transition convention these are the radii directly adjacent to
+// the clothoid. If the clothoid connects two radii of different size, the
+// tighter one is used and ambiguous is set. The start and end of the
+// alignment count as straights (R=∞), so a leading or trailing clothoid
+// transitions to the radius on its other side. Clothoids without adjacent
+// radius fall back to the nearest radius, see checkIsolatedClothoids.
+//
+// With the nearest convention it is always the nearest radius.
+func getClothoidRadius(elements []*Element, pos int) (result *Element, ambiguous bool, err error) {
+	switch *clothoidRadius {
+	case "nearest":
+		return getNearestRadius(elements, pos), false, nil
+	case "transition":
+	default:
+		return nil, false, fmt.Errorf("unknown clothoid radius convention (%v)", *clothoidRadius)
+	}
+
+	var p, n *Element
+	if pos > 0 && elements[pos-1].Type == Radius {
+		p = elements[pos-1]
+	}
+	if pos < len(elements)-1 && elements[pos+1].Type == Radius {
+		n = elements[pos+1]
+	}
+	switch {
+	case p != nil && n != nil:
+		ambiguous = math.Abs(p.Radius) != math.Abs(n.Radius)
+		if math.Abs(p.Radius) < math.Abs(n.Radius) {
+			return p, ambiguous, nil
+		}
+		return n, ambiguous, nil
+	case p != nil:
+		return p, false, nil
+	case n != nil:
+		return n, false, nil
+	}
+	return getNearestRadius(elements, pos), false, nil
+}
+
+func getDirectedNextRadius(elements []*Element, pos, increment int) (result *Element, distance int) {
+	for i := pos + increment; i >= 0 && i < len(elements); i += increment {
+		distance++
+		if elements[i].Type == Radius {
+			result = elements[i]
+			break
+		}
+	}
+	return
+}
+
+// checkCurvatureChanges flags consecutive radii which are only separated by
+// clothoids if their curvature changes faster than allowed along the
+// clothoids. Directly adjacent radii change their curvature instantly.
+func checkCurvatureChanges(elements []*Element) {
+	for i, e := range elements {
+		if e.Type != Radius {
+			continue
+		}
+		var transition float64
+		j := i + 1
+		for ; j < len(elements) && elements[j].Type == Clothoid; j++ {
+			transition += elements[j].Length
+		}
+		if j == len(elements) || elements[j].Type != Radius {
+			continue
+		}
+		n := elements[j]
+		change := math.Abs(1/n.Radius - 1/e.Radius)
+		if change == 0 {
+			continue
+		}
+		if transition == 0 || change/transition > *maxCurvatureRate {
+			e.report(ECurvatureChange, change, transition**maxCurvatureRate)
+			n.report(ECurvatureChange, change, transition**maxCurvatureRate)
+		}
+	}
+}
+
+// checkVpSpikes flags short elements whose vp is higher or lower than the
+// vp of both neighbors by more than vpSpike
+func checkVpSpikes(elements []*Element) {
+	for i := 1; i < len(elements)-1; i++ {
+		p, e, n := elements[i-1], elements[i], elements[i+1]
+		if e.Length > *vpSpikeLength {
+			continue
+		}
+		spike := e.Vp-p.Vp > *vpSpike && e.Vp-n.Vp > *vpSpike
+		dip := p.Vp-e.Vp > *vpSpike && n.Vp-e.Vp > *vpSpike
+		if spike || dip {
+			step := min(abs(e.Vp-p.Vp), abs(e.Vp-n.Vp))
+			e.report(EVpSpike, float64(step), float64(*vpSpike))
+		}
+	}
+}
+
+// checkMissingClothoids flags radii below -missing-clothoid-radius which
+// are directly adjacent to a straight
+func checkMissingClothoids(elements []*Element) {
+	for i, e := range elements {
+		if e.Type != Radius || math.Abs(e.Radius) >= *missingClothoidRadius {
+			continue
+		}
+		if (i > 0 && elements[i-1].Type == Straight) ||
+			(i < len(elements)-1 && elements[i+1].Type == Straight) {
+			e.report(EMissingClothoid, math.Abs(e.Radius), *missingClothoidRadius)
+		}
+	}
+}
+
+// neighborType returns the type of element i, the start and end of the
+// alignment count as straights
+func neighborType(elements []*Element, i int) ElementType {
+	if i < 0 || i >= len(elements) {
+		return Straight
+	}
+	return elements[i].Type
+}
+
+// checkIsolatedClothoids flags clothoids between two straights, which
+// cannot be built as there is no curvature to transition to
+func checkIsolatedClothoids(elements []*Element) {
+	for i, e := range elements {
+		if e.Type == Clothoid &&
+			neighborType(elements, i-1) == Straight &&
+			neighborType(elements, i+1) == Straight {
+			e.report(EIsolatedClothoid, 0, 0)
+		}
+	}
+}
+
+// checkInflections flags adjacent clothoids turning in opposite directions
+// whose parameters A differ by more than -inflection-tolerance. Such an S
+// curve is built from two clothoids of equal A meeting at the inflection.
+// Adjacent clothoids turning the same way form an egg shaped transition
+// between two radii, which needs no equal A.
+func checkInflections(elements []*Element) error {
+	for i := 0; i < len(elements)-1; i++ {
+		e, n := elements[i], elements[i+1]
+		if e.Type != Clothoid || n.Type != Clothoid || e.Turn == 0 || e.Turn == n.Turn {
+			continue
+		}
+		r, _, err := getClothoidRadius(elements, i)
+		if err != nil {
+			return err
+		}
+		nr, _, err := getClothoidRadius(elements, i+1)
+		if err != nil {
+			return err
+		}
+		if r == nil || nr == nil {
+			continue
+		}
+		a, na := clothoidA(e, r), clothoidA(n, nr)
+		larger := math.Max(a, na)
+		if math.Abs(a-na) > *inflectionTolerance*larger {
+			e.report(EInflection, math.Abs(a-na), *inflectionTolerance*larger)
+			n.report(EInflection, math.Abs(a-na), *inflectionTolerance*larger)
+		}
+	}
+	return nil
+}
+
+// checkSymmetricClothoids flags radii whose entry and exit clothoids differ
+// by more than -symmetry-tolerance. Radii missing a clothoid on either side
+// are skipped, see checkMissingClothoids.
+func checkSymmetricClothoids(elements []*Element) {
+	for i := 1; i < len(elements)-1; i++ {
+		e := elements[i]
+		entry, exit := elements[i-1], elements[i+1]
+		if e.Type != Radius || entry.Type != Clothoid || exit.Type != Clothoid {
+			continue
+		}
+		longer := math.Max(entry.Length, exit.Length)
+		if math.Abs(entry.Length-exit.Length) > *symmetryTolerance*longer {
+			e.report(EAsymmetric, math.Abs(entry.Length-exit.Length), *symmetryTolerance*longer)
+		}
+	}
+}
+
+// checkGradeChanges flags adjacent elements whose grades differ by more
+// than -max-grade-change percent. Elements without grade are skipped.
+func checkGradeChanges(elements []*Element) {
+	for i := 1; i < len(elements); i++ {
+		p, e := elements[i-1], elements[i]
+		if p.HasGrade && e.HasGrade && math.Abs(e.Grade-p.Grade) > *maxGradeChange {
+			change := math.Abs(e.Grade - p.Grade)
+			p.report(EGradeChange, change, *maxGradeChange)
+			e.report(EGradeChange, change, *maxGradeChange)
+		}
+	}
+}
+
+// checkVpDiffs flags adjacent elements whose vp difference is too large.
+// It runs over every element pair, so it must not allocate for valid pairs.
+// Only invalid pairs allocate, report records a diagnostic with a message.
+func checkVpDiffs(elements []*Element) {
+	for i := 1; i < len(elements); i++ {
+		p, e := elements[i-1], elements[i]
+		if vpDiffInvalid(p.Vp, e.Vp) {
+			diff := float64(abs(e.Vp - p.Vp))
+			p.report(EVpDiff, diff, float64(*maxVpDiff))
+			e.report(EVpDiff, diff, float64(*maxVpDiff))
+		}
+	}
+}
+
+// vpDiffInvalid reports whether the vp difference between two adjacent
+// elements is too large. A difference of up to -max-vp-diff is allowed. If
+// vpBoundaryStrict is set and one of the elements has a vp of exactly
+// vpBoundary, a difference of -max-vp-diff is already invalid.
+func vpDiffInvalid(a, b int) bool {
+	diff := abs(a - b)
+	if *vpBoundaryStrict && (a == *vpBoundary || b == *vpBoundary) {
+		return diff >= *maxVpDiff
+	}
+	return diff > *maxVpDiff
+}
+
+// arBoundsValid reports whether the clothoid parameter A lies within
+// -ar-min and -ar-max times the radius. A given A is used as is, otherwise
+// it follows from A² = R·L.
+func arBoundsValid(clothoid, radius *Element) bool {
+	r := math.Abs(radius.Radius)
+	a := clothoidA(clothoid, radius)
+	return a >= *arMin*r && a <= *arMax*r
+}
+
+// shorter reports whether length falls below limit by more than
+// -length-epsilon, so rounding and float noise don't flag a length
+func shorter(length, limit float64) bool {
+	return length < limit-*lengthEpsilon
+}
+
+// longer reports whether length exceeds limit by more than -length-epsilon
+func longer(length, limit float64) bool {
+	return length > limit+*lengthEpsilon
+}
+
+// clothoidA returns the given parameter A of a clothoid or else derives it
+// from its length and the radius it leads to
+func clothoidA(clothoid, radius *Element) float64 {
+	if clothoid.HasA {
+		return clothoid.AActual
+	}
+	return math.Sqrt(math.Abs(radius.Radius) * clothoid.Length)
+}
+
+// requiredCant returns the cant in percent needed to drive a curve at the
+// given vp. The centrifugal acceleration not taken by side friction is
+// compensated by the cant:
+//
+//	cant = 100 * (vp² / (127 * |radius|) - friction)
+func requiredCant(vp int, radius float64) float64 {
+	cant := 100 * (float64(vp*vp)/(127*math.Abs(radius)) - *cantFriction)
+	return math.Max(0, cant)
+}
+
+// requiredWidening returns the widening in m a curve needs for the
+// offtracking of the design vehicle on each lane:
+//
+//	widening = lanes * wheelbase² / (2 * |radius|)
+func requiredWidening(radius float64) float64 {
+	return float64(*wideningLanes) * *wheelbase * *wheelbase / (2 * math.Abs(radius))
+}
+
+// deflection returns the angle in degrees a radius element turns by. It is
+// 0 for other elements.
+func deflection(e *Element) float64 {
+	if e.Type != Radius || e.Radius == 0 {
+		return 0
+	}
+	return e.Length / math.Abs(e.Radius) * 180 / math.Pi
+}
+
+// traversalTime returns the seconds needed to drive the element at its vp
+func traversalTime(e *Element) float64 {
+	return e.Length / (float64(e.Vp) / 3.6)
+}
+
+func drivingSecondLength(vp int, seconds float64) float64 {
+	return float64(vp) / 3.6 * seconds
+}
+
+// bucketConflict reports whether an element shorter than its minimum
+// length is a conflict between the straight vp buckets and the driving
+// seconds: a straight long enough at the vp of its radii, which is only too
+// short for the higher vp of its bucket.
+func bucketConflict(e *Element) bool {
+	return e.Type == Straight && e.radiusVp > 0 && e.radiusVp < e.Vp &&
+		!shorter(e.Length, e.MinLength*float64(e.radiusVp)/float64(e.Vp))
+}
+
+// parallelEach calls fn for every element, splitting the elements evenly
+// between one worker per available processor. fn must only depend on and
+// modify the element it is called with. A worker stops at the first error
+// of fn, the error of the earliest element is returned.
+func parallelEach(elements []*Element, fn func(e *Element) error) error {
+	workers := runtime.GOMAXPROCS(0)
+	chunk := (len(elements) + workers - 1) / workers
+	if chunk == 0 {
+		return nil
+	}
+	errs := make([]error, (len(elements)+chunk-1)/chunk)
+	var wg sync.WaitGroup
+	for start := 0; start < len(elements); start += chunk {
+		wg.Add(1)
+		go func(part []*Element, err *error) {
+			defer wg.Done()
+			for _, e := range part {
+				if *err = fn(e); *err != nil {
+					return
+				}
+			}
+		}(elements[start:min(start+chunk, len(elements))], &errs[start/chunk])
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// progress prints the number of processed elements of the current
+// analysis step to stderr. Nothing is printed if disabled.
+type progress struct {
+	enabled bool
+	total   int
+	step    int
+}
+
+func newProgress(total int) *progress {
+	return &progress{
+		enabled: *showProgress && isTerminal(os.Stderr),
+		total:   total,
+		step:    max(1, total/100),
+	}
+}
+
+func (p *progress) update(label string, done int) {
+	if !p.enabled || (done%p.step != 0 && done != p.total) {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\r\033[K%s: %d/%d", label, done, p.total)
+}
+
+// clear erases the progress line
+func (p *progress) clear() {
+	if p.enabled {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+}
+
+// isTerminal reports whether f is a character device. It is a variable so
+// tests can pretend to write to a terminal.
+var isTerminal = func(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// selectInvalid returns all elements with errors together with n elements
+// before and after each of them. Those surrounding elements are returned
+// as context.
+func selectInvalid(elements []*Element, n int) (result []*Element, context map[*Element]bool) {
+	context = make(map[*Element]bool)
+	next := 0 // first element which wasn't selected yet
+	for i, e := range elements {
+		if e.Errors == 0 {
+			continue
+		}
+		for j := max(next, i-n); j <= min(len(elements)-1, i+n); j++ {
+			result = append(result, elements[j])
+			if elements[j].Errors == 0 {
+				context[elements[j]] = true
+			}
+		}
+		next = max(next, i+n+1)
+	}
+	return
+}
+
+// Summary aggregates the results of an analysis
+type Summary struct {
+	Elements    int     `json:"elements"`
+	Invalid     int     `json:"invalid"`
+	TotalLength float64 `json:"totalLength"`
+	MeanVp      float64 `json:"meanVp,omitempty"`
+	HasMeanVp   bool    `json:"-"`
+
+	HarmonicMeanVp    float64 `json:"harmonicMeanVp,omitempty"`
+	HasHarmonicMeanVp bool    `json:"-"`
+
+	// largest vp difference between consecutive elements and the id of
+	// the element it leads to
+	WorstVpStep    int  `json:"worstVpStep"`
+	WorstVpStepID  int  `json:"worstVpStepId,omitempty"`
+	HasWorstVpStep bool `json:"-"`
+
+	// energy estimate in kWh, only computed with -energy
+	Energy float64 `json:"energyKWh,omitempty"`
+
+	// length per vp band, only computed with -vp-bands
+	VpBands []VpBand `json:"vpBands,omitempty"`
+}
+
+// VpBand is the length of all elements with a vp from Min up to but
+// excluding Max. A Max of 0 leaves the band open.
+type VpBand struct {
+	Min    int     `json:"min"`
+	Max    int     `json:"max,omitempty"`
+	Length float64 `json:"length"`
+}
+
+// Summarize computes the summary of analyzed elements
+func Summarize(elements []*Element) (result Summary) {
+	result.Elements = len(elements)
+	for _, e := range elements {
+		if e.Errors != 0 {
+			result.Invalid++
+		}
+		result.TotalLength += e.Length
+	}
+	result.MeanVp, result.HasMeanVp = ComputeMeanVp(elements)
+	result.HarmonicMeanVp, result.HasHarmonicMeanVp = ComputeHarmonicMeanVp(elements)
+	if i, diff := WorstVpTransition(elements); i >= 0 {
+		result.WorstVpStep = diff
+		result.WorstVpStepID = elements[i].ID
+		result.HasWorstVpStep = true
+	}
+	return
+}
+
+// WorstVpTransition returns the largest vp difference between consecutive
+// elements and the index of the element it leads to. The first of several
+// equal steps wins. i is -1 for less than two elements.
+func WorstVpTransition(elements []*Element) (i int, diff int) {
+	i = -1
+	for j := 1; j < len(elements); j++ {
+		if d := abs(elements[j].Vp - elements[j-1].Vp); i < 0 || d > diff {
+			i, diff = j, d
+		}
+	}
+	return
+}
+
+// writeSummaryKV writes the summary as key=value lines. Values which
+// aren't available are left out.
+func writeSummaryKV(w io.Writer, summary Summary) {
+	fmt.Fprintf(w, "elements=%v\n", summary.Elements)
+	fmt.Fprintf(w, "errors=%v\n", summary.Invalid)
+	fmt.Fprintf(w, "total_length=%.2f\n", summary.TotalLength)
+	if summary.HasMeanVp {
+		fmt.Fprintf(w, "mean_vp=%.2f\n", summary.MeanVp)
+	}
+	if summary.HasHarmonicMeanVp {
+		fmt.Fprintf(w, "harmonic_mean_vp=%.2f\n", summary.HarmonicMeanVp)
+	}
+	if summary.HasWorstVpStep {
+		fmt.Fprintf(w, "worst_vp_step=%v\n", summary.WorstVpStep)
+		fmt.Fprintf(w, "worst_vp_step_id=%v\n", summary.WorstVpStepID)
+	}
+	if *showEnergy {
+		fmt.Fprintf(w, "energy_kwh=%.3f\n", summary.Energy)
+	}
+}
+
+// ComputeMeanVp returns the length weighted mean vp. ok is false if the
+// elements have no length at all.
+func ComputeMeanVp(elements []*Element) (mean float64, ok bool) {
+	var totalLength float64
+	var vpProduct float64
+	for _, e := range elements {
+		totalLength += e.Length
+		vpProduct += e.Length * float64(e.Vp)
+	}
+	if totalLength == 0 {
+		return 0, false
+	}
+	return vpProduct / totalLength, true
+}
+
+// meetsTargetVp reports whether the mean vp reaches target within tolerance.
+// A missing mean never reaches it.
+func meetsTargetVp(summary Summary, target int, tolerance float64) bool {
+	return summary.HasMeanVp && summary.MeanVp >= float64(target)-tolerance
+}
+
+// filterMinLength returns the elements which are at least minLength long
+func filterMinLength(elements []*Element, minLength float64) (result []*Element) {
+	for _, e := range elements {
+		if e.Length >= minLength {
+			result = append(result, e)
+		}
+	}
+	return
+}
+
+// ComputeHarmonicMeanVp returns the length weighted harmonic mean vp which
+// corresponds to the average speed when driving all elements at their vp:
+//
+//	mean = sum(length) / sum(length / vp)
+//
+// Elements without vp are skipped. ok is false if no element remains.
+func ComputeHarmonicMeanVp(elements []*Element) (mean float64, ok bool) {
+	var totalLength float64
+	var timeSum float64
+	for _, e := range elements {
+		if e.Vp == 0 {
+			continue
+		}
+		totalLength += e.Length
+		timeSum += e.Length / float64(e.Vp)
+	}
+	if timeSum == 0 {
+		return 0, false
+	}
+	return totalLength / timeSum, true
+}
+
+// ComputeVpBands returns the length of the elements in each band between
+// the ascending bounds
+func ComputeVpBands(elements []*Element, bounds []int) []VpBand {
+	bands := make([]VpBand, len(bounds)+1)
+	for i := range bands {
+		if i > 0 {
+			bands[i].Min = bounds[i-1]
+		}
+		if i < len(bounds) {
+			bands[i].Max = bounds[i]
+		}
+	}
+	for _, e := range elements {
+		i := sort.SearchInts(bounds, e.Vp+1)
+		bands[i].Length += e.Length
+	}
+	return bands
+}
+
+// parseVpBands parses the comma separated bounds of -vp-bands
+func parseVpBands(s string) ([]int, error) {
+	var bounds []int
+	for _, field := range strings.Split(s, ",") {
+		vp, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		bounds = append(bounds, vp)
+	}
+	if !sort.IntsAreSorted(bounds) {
+		return nil, fmt.Errorf("bounds %v aren't ascending", s)
+	}
+	return bounds, nil
+}
+
+// printVpBands prints the kilometers and share of each vp band
+func printVpBands(bands []VpBand, totalLength float64) {
+	fmt.Println("vp bands:")
+	for _, band := range bands {
+		var name string
+		switch {
+		case band.Min == 0:
+			name = fmt.Sprintf("< %v", band.Max)
+		case band.Max == 0:
+			name = fmt.Sprintf(">= %v", band.Min)
+		default:
+			name = fmt.Sprintf("%v-%v", band.Min, band.Max-1)
+		}
+		share := 0.0
+		if totalLength > 0 {
+			share = band.Length / totalLength * 100
+		}
+		fmt.Printf("  %v km/h: %.3f km (%.1f%%)\n", name, band.Length/1000, share)
+	}
+}
+
+// ComputeEnergy returns a rough estimate in kWh of the energy a vehicle of
+// mass m needs to drive the alignment at vp. It is an approximation for
+// comparing alignments, not a consumption figure:
+//
+//	energy = m * g * rolling * sum(length) + sum(m / 2 * (v₂² - v₁²))
+//
+// The second sum only covers vp increases. The kinetic energy is assumed
+// to be lost completely when slowing down, air drag, grades and drivetrain
+// losses are ignored. So more vp changes cost more energy.
+func ComputeEnergy(elements []*Element, m, rolling float64) float64 {
+	const g = 9.81
+	var joule float64
+	for i, e := range elements {
+		joule += m * g * rolling * e.Length
+		if i == 0 {
+			continue
+		}
+		v1 := float64(elements[i-1].Vp) / 3.6
+		v2 := float64(e.Vp) / 3.6
+		if v2 > v1 {
+			joule += m / 2 * (v2*v2 - v1*v1)
+		}
+	}
+	return joule / 3.6e6
+}
+
+// severityScore ranks how problematic an element is:
+//
+//	10 points per error flag and 5 points per warning flag
+//	+ the shortfall below the minimum length in percent
+//	+ the largest vp difference to a neighbor in km/h, if it is flagged
+func severityScore(elements []*Element, pos int) (score float64) {
+	e := elements[pos]
+	for _, info := range flagInfos {
+		if e.Errors&info.flag == 0 {
+			continue
+		}
+		if info.severity == SeverityError {
+			score += 10
+		} else {
+			score += 5
+		}
+	}
+	if e.Errors&EMinLength != 0 && e.MinLength > 0 {
+		score += (e.MinLength - e.Length) / e.MinLength * 100
+	}
+	if e.Errors&EVpDiff != 0 {
+		jump := 0
+		if pos > 0 {
+			jump = max(jump, abs(e.Vp-elements[pos-1].Vp))
+		}
+		if pos < len(elements)-1 {
+			jump = max(jump, abs(e.Vp-elements[pos+1].Vp))
+		}
+		score += float64(jump)
+	}
+	return
+}
+
+// printWorst prints the n flagged elements with the highest severity score
+func printWorst(elements []*Element, n int) {
+	type scored struct {
+		element *Element
+		score   float64
+	}
+	var ranking []scored
+	for i, e := range elements {
+		if e.Errors != 0 {
+			ranking = append(ranking, scored{e, severityScore(elements, i)})
+		}
+	}
+	sort.SliceStable(ranking, func(i, j int) bool {
+		return ranking[i].score > ranking[j].score
+	})
+	if len(ranking) > n {
+		ranking = ranking[:n]
+	}
+
+	fmt.Println("worst elements:")
+	for i, r := range ranking {
+		fmt.Printf("%3d. #%v %v (score %.1f): %v\n",
+			i+1,
+			r.element.ID,
+			r.element.Type,
+			r.score,
+			strings.Join(append(
+				flagNames(r.element.Errors, SeverityError),
+				flagNames(r.element.Errors, SeverityWarning)...), ", "))
+	}
+}
+
+// printClamped lists the radii which would allow a higher vp than -max-vp
+func printClamped(elements []*Element) {
+	fmt.Println("clamped radii:")
+	for _, e := range elements {
+		if e.Clamped {
+			fmt.Printf("  #%v radius %.2f allows %v km/h, clamped to %v km/h\n",
+				e.ID,
+				e.Radius,
+				determineRadiusVp(e.Radius),
+				e.Vp)
+		}
+	}
+}
+
+// failingFlags returns the element flags which fail a run
+func failingFlags() Flag {
+	if *failOn != "" {
+		failing, err := parseFlagNames(*failOn)
+		if err != nil {
+			log.Fatalf("invalid -fail-on: %v", err)
+		}
+		return failing
+	}
+	failing := severityFlags(SeverityError)
+	if *werror {
+		failing |= severityFlags(SeverityWarning)
+	}
+	return failing
+}
+
+// failed reports whether any errors were found. Warnings count as errors
+// if werror is set. With -fail-on only the named element flags count, the
+// diagnostics of the whole alignment still do.
+func failed(elements []*Element, diagnostics []Diagnostic) bool {
+	failing := failingFlags()
+	for _, e := range elements {
+		if e.Errors&failing != 0 {
+			return true
+		}
+	}
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError || *werror {
+			return true
+		}
+	}
+	return false
+}
+
+// Analyze checks the parsed elements and sets their computed fields and
+// flags. Merging adjacent elements may shorten the slice, so the result
+// replaces elements. Findings about the whole alignment are returned as
+// diagnostics and logged to logger, which may be nil. An error means the
+// rules couldn't be applied, e.g. due to an invalid option.
+func Analyze(elements []*Element, logger *slog.Logger) ([]*Element, []Diagnostic, error) {
+	found := newFindings(logger)
+	checkDegenerate(elements, found)
+	if len(elements) == 0 {
+		return elements, found.diagnostics, nil
+	}
+	if *requireTangentEnds {
+		checkTangentEnds(elements, found)
+	}
+
+	if *mergeAdjacent {
+		elements = mergeElements(elements)
+	} else if *checkMergeableFlag {
+		checkMergeable(elements)
+	}
+
+	if *renumber {
+		renumberElements(elements, *renumberBase)
+	}
+	for i, e := range elements {
+		e.Index = i
+	}
+
+	computeStations(elements)
+	checkStations(elements)
+
+	computeRadii(elements, found)
+	if *normalizeRadiusSign {
+		normalizeRadiusSigns(elements, found)
+	}
+	computeGrades(elements)
+
+	// clear the progress line on errors too, before they are reported
+	prog := newProgress(len(elements))
+	defer prog.clear()
+
+	// determine radius vp and length of clothoids
+	err := parallelEach(elements, func(e *Element) error {
+		if e.Type == Radius {
+			e.Turn = radiusTurn(e.Radius)
+			vp := determineRadiusVp(e.Radius)
+			e.Vp = min(*maxVp, vp)
+			e.Clamped = vp > *maxVp
+			e.Derivation.Vp = fmt.Sprintf("radius %v allows %v km/h, at most %v km/h",
+				math.Abs(e.Radius),
+				vp,
+				*maxVp)
+
+			lClothMin, err := determineMinClothoidLength(e.Vp)
+			if err != nil {
+				return err
+			}
+			e.AMin = math.Sqrt(math.Abs(e.Radius) * lClothMin)
+			e.AMax = math.Sqrt(math.Abs(e.Radius) * lClothMin * 2)
+
+			e.Cant = requiredCant(e.Vp, e.Radius)
+			if *maxCant > 0 && e.Cant > *maxCant {
+				e.report(ECant, e.Cant, *maxCant)
+			}
+
+			minRadius, err := determineMinSightRadius(e.Vp)
+			if err != nil {
+				return err
+			}
+			if math.Abs(e.Radius) < minRadius {
+				e.report(ESightDistance, math.Abs(e.Radius), minRadius)
+			}
+
+			if *wheelbase > 0 {
+				e.Widening = requiredWidening(e.Radius)
+				if *maxWidening > 0 && e.Widening > *maxWidening {
+					e.report(EWidening, e.Widening, *maxWidening)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	prog.update("radius vp", len(elements))
+
+	// determine straigth vp
+	for i, e := range elements {
+		prog.update("straight vp", i+1)
+		if e.Type == Straight {
+			p := getPreviousRadius(elements, i)
+			n := getNextRadius(elements, i)
+			if p != nil {
+				e.PrevRadiusID = p.ID
+			}
+			if n != nil {
+				e.NextRadiusID = n.ID
+			}
+			radiusVp, err := combineRadiusVps(p, n)
+			if err != nil {
+				return nil, nil, err
+			}
+			e.radiusVp = radiusVp
+			e.Vp, err = determineStraightVp(radiusVp, e.Length)
+			if err != nil {
+				return nil, nil, err
+			}
+			e.Derivation.Vp = fmt.Sprintf("%v of the radius vps is %v km/h, straight vps with length %v give %v km/h",
+				*straightVpMode,
+				radiusVp,
+				e.Length,
+				e.Vp)
+			for _, r := range []*Element{p, n} {
+				if r != nil {
+					e.Derivation.Sources = append(e.Derivation.Sources, r.ID)
+				}
+			}
+		}
+	}
+
+	// determine clothoid vp
+	for i, e := range elements {
+		prog.update("clothoid vp", i+1)
+		if e.Type == Clothoid {
+			radius, ambiguous, err := getClothoidRadius(elements, i)
+			if err != nil {
+				return nil, nil, err
+			}
+			if radius == nil {
+				// no radius at all, see checkDegenerate
+				e.Vp = *maxVp
+				e.Derivation.Vp = "no radius, the maximum vp"
+				continue
+			}
+			e.Derivation.Vp = fmt.Sprintf("vp of the %v radius", *clothoidRadius)
+			e.Derivation.Sources = []int{radius.ID}
+			if ambiguous {
+				e.report(EAmbiguousClothoid, 0, 0)
+			}
+			e.Turn = radiusTurn(radius.Radius)
+			e.Vp = radius.Vp
+			e.AMin = radius.AMin
+			e.AMax = radius.AMax
+			e.Cant = radius.Cant
+			if *arBounds && !arBoundsValid(e, radius) {
+				ratio := clothoidA(e, radius) / math.Abs(radius.Radius)
+				e.report(EARBounds, ratio, min(max(ratio, *arMin), *arMax))
+			}
+		}
 	}
 
 	// determine minimum length of elements
 	for i, e := range elements {
+		prog.update("minimum length", i+1)
 		switch e.Type {
 		case Radius:
-			e.MinLength = drivingSecondLength(e.Vp, 1)
+			e.MinLength = drivingSecondLength(e.Vp, *radiusSeconds)
+			e.Derivation.MinLength = fmt.Sprintf("%v s at vp", *radiusSeconds)
 		case Straight:
-			e.MinLength = drivingSecondLength(e.Vp, 1)
-			// radi in the same direction need 5 seconds
+			e.MinLength = drivingSecondLength(e.Vp, *straightSeconds)
+			e.Derivation.MinLength = fmt.Sprintf("%v s at vp", *straightSeconds)
+			// radi in the same direction need longer straights
 			p := getPreviousRadius(elements, i)
 			n := getNextRadius(elements, i)
 			if p != nil && n != nil {
-				if p.Radius < 0 && n.Radius < 0 {
-					e.MinLength = drivingSecondLength(e.Vp, 5)
-				} else if p.Radius > 0 && n.Radius > 0 {
-					e.MinLength = drivingSecondLength(e.Vp, 5)
+				if (p.Radius < 0 && n.Radius < 0) || (p.Radius > 0 && n.Radius > 0) {
+					e.MinLength = drivingSecondLength(e.Vp, *sameDirectionSeconds)
+					e.Derivation.MinLength = fmt.Sprintf("%v s at vp between radii in the same direction",
+						*sameDirectionSeconds)
 				}
 			}
 		case Clothoid:
-			radius := getNearestRadius(elements, i)
-			e.MinLength = determineMinClothoidLength(radius.Vp)
+			e.MinLength, err = determineMinClothoidLength(e.Vp)
+			if err != nil {
+				return nil, nil, err
+			}
+			e.Derivation.MinLength = fmt.Sprintf("clothoid min lengths at %v km/h", e.Vp)
+			// the guidelines give no maximum, it is a project convention
+			e.MaxLength = *clothoidMaxFactor * e.MinLength
 		default:
-			log.Fatalf("unknown ElementType (%v)", e.Type)
+			return nil, nil, fmt.Errorf("unknown ElementType (%v)", e.Type)
 		}
 	}
 
 	// check vp differences
-	for i, e := range elements[:len(elements)-1] {
-		n := elements[i+1]
-		invalid := false
-		if e.Vp == 100 || n.Vp == 100 {
-			invalid = abs(e.Vp-n.Vp) >= 20
+	checkVpDiffs(elements)
+	prog.update("vp differences", len(elements))
+	// check the tie-ins to the connecting roads
+	if *startVp > 0 && vpDiffInvalid(*startVp, elements[0].Vp) {
+		elements[0].report(EVpDiff, float64(abs(*startVp-elements[0].Vp)), float64(*maxVpDiff))
+	}
+	if last := elements[len(elements)-1]; *endVp > 0 && vpDiffInvalid(last.Vp, *endVp) {
+		last.report(EVpDiff, float64(abs(last.Vp-*endVp)), float64(*maxVpDiff))
+	}
+	// check straights between clothoids
+	for i := 1; i < len(elements)-1; i++ {
+		e := elements[i]
+		if e.Type == Straight &&
+			elements[i-1].Type == Clothoid &&
+			elements[i+1].Type == Clothoid &&
+			shorter(e.Length, *minClothoidGap) {
+			e.report(EClothoidStraight, e.Length, *minClothoidGap)
+		}
+	}
+
+	// check curvature changes between curves
+	if *maxCurvatureRate > 0 {
+		checkCurvatureChanges(elements)
+	}
+
+	// check radii connecting to straights without clothoid
+	if *missingClothoidRadius > 0 {
+		checkMissingClothoids(elements)
+	}
+
+	// check clothoids without curvature on either side
+	checkIsolatedClothoids(elements)
+
+	// check the clothoids of s curves
+	if err := checkInflections(elements); err != nil {
+		return nil, nil, err
+	}
+
+	// check the symmetry of transitions
+	if *symmetricClothoids {
+		checkSymmetricClothoids(elements)
+	}
+
+	// check grade changes between elements
+	if *maxGradeChange > 0 {
+		checkGradeChanges(elements)
+	}
+
+	// check vp spikes and dips
+	if *vpSpike > 0 {
+		checkVpSpikes(elements)
+	}
+
+	// check lengths
+	err = parallelEach(elements, func(e *Element) error {
+		// a given parameter A is checked directly. As A² = R·L, its band
+		// is equivalent to the length band, which is skipped then.
+		if e.HasA {
+			if e.AActual < e.AMin || (e.AMax != 0 && e.AActual > e.AMax) {
+				limit := e.AMin
+				if e.AActual > e.AMin {
+					limit = e.AMax
+				}
+				e.report(EParameter, e.AActual, limit)
+			}
+			// the minimum transition length holds regardless of A
+			if shorter(e.Length, e.MinLength) {
+				e.report(ETransitionLength, e.Length, e.MinLength)
+			}
 		} else {
-			invalid = abs(e.Vp-n.Vp) > 20
+			if shorter(e.Length, e.MinLength) {
+				e.report(EMinLength, e.Length, e.MinLength)
+				if bucketConflict(e) {
+					e.report(EBucketConflict, e.Length, e.MinLength)
+				}
+			}
+			if e.MaxLength != 0 && longer(e.Length, e.MaxLength) {
+				e.report(EMaxLength, e.Length, e.MaxLength)
+			}
 		}
-		if invalid {
-			e.Errors |= EVpDiff
-			n.Errors |= EVpDiff
+		if e.Type == Clothoid && *cantRate > 0 && shorter(e.Length, e.Cant / *cantRate) {
+			e.report(ECantTransition, e.Length, e.Cant / *cantRate)
+		}
+		if *minVp > 0 && e.Vp < *minVp {
+			e.report(EBelowMinVp, float64(e.Vp), float64(*minVp))
+		}
+		if e.Type == Straight && *maxStraightFactor > 0 && longer(e.Length, *maxStraightFactor*float64(e.Vp)) {
+			e.report(EMaxStraight, e.Length, *maxStraightFactor*float64(e.Vp))
+		}
+		if e.HasGrade {
+			maxGrade, err := determineMaxGrade(e.Vp)
+			if err != nil {
+				return err
+			}
+			if math.Abs(e.Grade) > maxGrade {
+				e.report(EGrade, math.Abs(e.Grade), maxGrade)
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
-	// check lengths
-	for _, e := range elements {
-		if e.Length < e.MinLength {
-			e.Errors |= EMinLength
+	prog.update("lengths", len(elements))
+
+	return elements, found.diagnostics, nil
+}
+
+func main() {
+	flag.Var(&sightDistances, "ssd", "override stopping sight distances (vp=distance,...)")
+	flag.Var(&metaFields, "meta", "report header cells (name=row:col,...), e.g. project=1:1")
+	flag.Parse()
+	recordCommandLine()
+	if *configFile != "" {
+		loadConfig(*configFile)
+	}
+	if *dumpRules {
+		writeRules(os.Stdout)
+		return
+	}
+	if *generateSample > 0 {
+		writeSample(os.Stdout, *generateSample)
+		return
+	}
+	// without input there are no header params to apply
+	if *printConfig && flag.NArg() == 0 {
+		writeConfig(os.Stdout)
+		return
+	}
+
+	file, err := os.Open(flag.Args()[0])
+	if err != nil {
+		log.Fatalf("failed opening the file: %v", err)
+	}
+	defer file.Close()
+
+	opts := optionsFromFlags()
+	opts.Header = func(line int, row []string) error {
+		captureMeta(line, row)
+		if *headerParams {
+			return applyHeaderParams(row)
+		}
+		return nil
+	}
+	elements, parseDiags, err := Parse(decodeInput(file), opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *printConfig {
+		writeConfig(os.Stdout)
+		return
+	}
+	var parseErrors []string
+	for _, d := range parseDiags {
+		if d.Severity == SeverityError {
+			parseErrors = append(parseErrors, d.Message)
+		}
+	}
+	if *parseOnly {
+		for _, message := range parseErrors {
+			fmt.Println(message)
+		}
+		if len(parseErrors) > 0 {
+			os.Exit(1)
+		}
+		fmt.Printf("OK: %v elements parsed\n", len(elements))
+		return
+	}
+	if len(parseErrors) > 0 {
+		for _, message := range parseErrors {
+			log.Print(message)
+		}
+		os.Exit(1)
+	}
+	found := newFindings(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	for _, d := range parseDiags {
+		if d.Severity == SeverityWarning {
+			found.warnf("%v", d.Message)
+		}
+	}
+	if len(elements) == 0 {
+		if *requireElements || *strict || *werror {
+			log.Fatalf("no elements found, check -header-rows and -footer-rows")
+		}
+		if *countOnly {
+			fmt.Println(0)
+		} else {
+			fmt.Println("no elements found")
+		}
+		return
+	}
+
+	elements, diagnostics, err := Analyze(elements, found.logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+	found.diagnostics = append(found.diagnostics, diagnostics...)
+	if *baselineFile != "" {
+		baseline := readBaseline(*baselineFile)
+		for _, e := range elements {
+			e.suppress(baseline[e.ID])
 		}
 	}
 
 	var table [][]string
 	if *printAll {
-		table = createTable(elements)
+		table = createTable(elements, nil)
 	} else {
-		var invalid []*Element
-		for _, e := range elements {
-			if e.Errors != 0 {
-				invalid = append(invalid, e)
-			}
+		table = createTable(selectInvalid(elements, *contextRows))
+	}
+
+	summary := Summarize(elements)
+	if *showEnergy {
+		summary.Energy = ComputeEnergy(elements, *vehicleMass, *rollingResistance)
+	}
+	if *vpBands != "" {
+		bounds, err := parseVpBands(*vpBands)
+		if err != nil {
+			log.Fatalf("invalid -vp-bands: %v", err)
+		}
+		summary.VpBands = ComputeVpBands(elements, bounds)
+	}
+	targetMet := true
+	if *targetVp > 0 {
+		targetMet = meetsTargetVp(summary, *targetVp, *targetVpTolerance)
+		if !targetMet {
+			found.errorf("mean vp %.2f km/h is below the target vp of %v km/h",
+				summary.MeanVp,
+				*targetVp)
 		}
-		table = createTable(invalid)
 	}
-	printTable(table)
 
 	if *exportCSV != "" {
-		writeCSV(table)
+		csvTable := table
+		if *csvErrorsOnly || *csvRaw {
+			format := printFloat
+			if *csvRaw {
+				format = rawFloat
+			}
+			selected, context := elements, map[*Element]bool(nil)
+			if *csvErrorsOnly {
+				selected, context = selectInvalid(elements, 0)
+			} else if !*printAll {
+				selected, context = selectInvalid(elements, *contextRows)
+			}
+			csvTable = createFormattedTable(selected, context, format)
+		}
+		if *csvTotals {
+			csvTable = append(csvTable, totalsRow(csvTable[0], summary))
+		}
+		writeCSV(csvTable)
+	}
+	if *showTotals {
+		table = append(table, totalsRow(table[0], summary))
+	}
+	if *jsonOut != "" {
+		writeFile(*jsonOut, func(w io.Writer) {
+			writeJSON(w, elements, summary)
+		})
+	}
+	if *profileCSV != "" {
+		writeFile(*profileCSV, func(w io.Writer) {
+			writeProfile(w, elements, *profileStep)
+		})
+	}
+	if *htmlOut != "" {
+		writeFile(*htmlOut, func(w io.Writer) {
+			writeHTML(w, table)
+		})
+	}
+	if *auditOut != "" {
+		writeFile(*auditOut, func(w io.Writer) {
+			writeAudit(w, elements)
+		})
+	}
+	if *junitOut != "" {
+		writeFile(*junitOut, func(w io.Writer) {
+			writeJUnit(w, elements, found.diagnostics)
+		})
+	}
+	if *metricsOut != "" {
+		writeFile(*metricsOut, func(w io.Writer) {
+			writeMetrics(w, elements, summary)
+		})
+	}
+	if *ndjson {
+		writeNDJSON(os.Stdout, elements, summary)
+	} else if *countOnly {
+		fmt.Println(summary.Invalid)
+	} else if *summaryKV {
+		writeSummaryKV(os.Stdout, summary)
+	} else if *tsv {
+		writeTSV(os.Stdout, table)
+	} else if *tui {
+		if err := runTUI(createTable(elements, nil)); err != nil {
+			log.Fatalf("failed running the tui: %v", err)
+		}
+	} else {
+		writeBanner(os.Stdout)
+		printTable(table, *maxRows)
+		if *worst > 0 {
+			printWorst(elements, *worst)
+		}
+		if *reportClamped {
+			printClamped(elements)
+		}
+		if *explainErrors {
+			printExplanations(os.Stdout, elements)
+		}
+		if summary.HasMeanVp {
+			fmt.Printf("mean vp: %.2f km/h\n", summary.MeanVp)
+		} else {
+			fmt.Println("mean vp: n/a")
+		}
+		if summary.HasHarmonicMeanVp {
+			fmt.Printf("harmonic mean vp: %.2f km/h\n", summary.HarmonicMeanVp)
+		}
+		if summary.VpBands != nil {
+			printVpBands(summary.VpBands, summary.TotalLength)
+		}
+		if *showEnergy {
+			fmt.Printf("energy estimate: %.3f kWh\n", summary.Energy)
+		}
+		if summary.HasWorstVpStep {
+			fmt.Printf("worst vp step: %v km/h at element #%v\n",
+				summary.WorstVpStep,
+				summary.WorstVpStepID)
+		}
+		if *meanMinLength > 0 {
+			mean, ok := ComputeMeanVp(filterMinLength(elements, *meanMinLength))
+			if ok {
+				fmt.Printf("mean vp (elements >= %.2f m): %.2f km/h\n",
+					*meanMinLength,
+					mean)
+			} else {
+				fmt.Printf("mean vp (elements >= %.2f m): n/a\n", *meanMinLength)
+			}
+		}
+		if *targetVp > 0 {
+			result := "passed"
+			if !targetMet {
+				result = "failed"
+			}
+			fmt.Printf("target vp %v km/h: %v\n", *targetVp, result)
+		}
 	}
 
-	// calculate mean vp
-	var totalLength float64
-	var vpProduct float64
-	for _, e := range elements {
-		totalLength += e.Length
-		vpProduct += e.Length * float64(e.Vp)
+	if (*strict || *werror || *failOn != "") && failed(elements, found.diagnostics) {
+		os.Exit(1)
 	}
-	meanVp := vpProduct / totalLength
-	fmt.Printf("mean vp: %.2f km/h\n", meanVp)
 }
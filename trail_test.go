@@ -0,0 +1,2316 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/olekukonko/tablewriter"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"os/exec"
+	"reflect"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestMain runs main instead of the tests if TRAIL_MAIN_ARGS is set, see
+// runMain
+func TestMain(m *testing.M) {
+	if args, ok := os.LookupEnv("TRAIL_MAIN_ARGS"); ok {
+		os.Args = append([]string{"trail"}, strings.Split(args, "\n")...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMain runs the program with args in a subprocess and returns its
+// output and exit code
+func runMain(t *testing.T, args ...string) (stdout, stderr string, code int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), "TRAIL_MAIN_ARGS="+strings.Join(args, "\n"))
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return out.String(), errOut.String(), code
+}
+
+// setFlag sets the named flag for the rest of the test
+func setFlag(t *testing.T, name, value string) {
+	t.Helper()
+	f := flag.Lookup(name)
+	if f == nil {
+		t.Fatalf("unknown flag %v", name)
+	}
+	old := f.Value.String()
+	if err := f.Value.Set(value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Value.Set(old) })
+}
+
+// alignment returns an input file in the default layout with a row for
+// each element given as type,length[,radius]
+func alignment(elements ...string) string {
+	var b strings.Builder
+	b.WriteString("Projekt,B1,,,,,\nDatum,2020-01-01,,,,,\nId,Typ,Station,Länge,A,,Radius\n")
+	for i, e := range elements {
+		fields := append(strings.Split(e, ","), "")
+		fmt.Fprintf(&b, "%v,%v,,%v,,,%v\n", i+1, fields[0], fields[1], fields[2])
+	}
+	b.WriteString("Summe,,,,,,\n")
+	return b.String()
+}
+
+// withColumn sets column col of the element rows of an alignment to values
+func withColumn(input string, col int, values ...string) string {
+	lines := strings.Split(input, "\n")
+	for i, value := range values {
+		fields := strings.Split(lines[3+i], ",")
+		fields[col] = value
+		lines[3+i] = strings.Join(fields, ",")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writeInput writes input to a file in a temporary directory
+func writeInput(t *testing.T, input string) string {
+	t.Helper()
+	path := t.TempDir() + "/input.csv"
+	if err := os.WriteFile(path, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// parse parses input with the options of the flags and fails on errors
+func parse(t *testing.T, input string) []*Element {
+	t.Helper()
+	elements, diags, err := Parse(strings.NewReader(input), optionsFromFlags())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range diags {
+		if d.Severity == SeverityError {
+			t.Fatal(d.Message)
+		}
+	}
+	return elements
+}
+
+// analyze parses and analyzes input
+func analyze(t *testing.T, input string) []*Element {
+	t.Helper()
+	elements, _, err := Analyze(parse(t, input), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return elements
+}
+
+// hasRow reports whether the rendered table has a row for element id
+func hasRow(table string, id int) bool {
+	return regexp.MustCompile(fmt.Sprintf(`(?m)^\|\s*%v\s*\|`, id)).MatchString(table)
+}
+
+// hasFlag reports whether e has a diagnostic for f
+func hasFlag(e *Element, f Flag) bool {
+	return diagnosticFlags(e.Diagnostics)&f != 0
+}
+
+// diagnostic returns the diagnostic of e for f
+func diagnostic(t *testing.T, e *Element, f Flag) Diagnostic {
+	t.Helper()
+	for _, d := range e.Diagnostics {
+		if d.flag == f {
+			return d
+		}
+	}
+	t.Fatalf("element %v has no diagnostic %v", e.ID, stringifyCodes(f))
+	return Diagnostic{}
+}
+
+func TestParseReportsInvalidRows(t *testing.T) {
+	input := alignment("Gerade,100", "Radius,x,300", "Gerade,100")
+	elements, diags, err := Parse(strings.NewReader(input), optionsFromFlags())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(elements) != 2 {
+		t.Errorf("got %v elements, want 2", len(elements))
+	}
+	if len(diags) != 1 || diags[0].Severity != SeverityError || !strings.HasPrefix(diags[0].Message, "line 5:") {
+		t.Errorf("got diagnostics %+v, want an error on line 5", diags)
+	}
+}
+
+func TestParseHeaderMapKeepsFlags(t *testing.T) {
+	input := "Nr,Länge,Typ,Radius,A\n1,100,Gerade,,\n2,50,Klothoide,,80\n3,100,Radius,400,\n"
+	opts := optionsFromFlags()
+	opts.HeaderRows, opts.HeaderMap, opts.FooterRows = 1, 1, 0
+	elements, diags, err := Parse(strings.NewReader(input), opts)
+	if err != nil || len(diags) > 0 {
+		t.Fatal(err, diags)
+	}
+	if len(elements) != 3 || elements[2].Radius != 400 || elements[1].AActual != 80 {
+		t.Errorf("columns not mapped: %+v", elements)
+	}
+	if *colLength != 3 || *colA != -1 {
+		t.Errorf("header map changed the column flags to %v and %v", *colLength, *colA)
+	}
+}
+
+func TestParseHeaderCallback(t *testing.T) {
+	opts := optionsFromFlags()
+	var lines []int
+	opts.Header = func(line int, row []string) error {
+		lines = append(lines, line)
+		return nil
+	}
+	if _, _, err := Parse(strings.NewReader(alignment("Gerade,100")), opts); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(lines) != "[1 2 3]" {
+		t.Errorf("header called for lines %v", lines)
+	}
+	opts.Header = func(int, []string) error { return errors.New("bad header") }
+	if _, _, err := Parse(strings.NewReader(alignment("Gerade,100")), opts); err == nil || err.Error() != "line 1: bad header" {
+		t.Errorf("got %v, want the header error", err)
+	}
+}
+
+func TestAnalyzeEmpty(t *testing.T) {
+	setFlag(t, "require-tangent-ends", "true")
+	setFlag(t, "start-vp", "80")
+	elements, diags, err := Analyze(nil, nil)
+	if err != nil || len(elements) != 0 {
+		t.Errorf("got %v elements", len(elements))
+	}
+	if len(diags) == 0 {
+		t.Error("no warning about the empty alignment")
+	}
+	computeGrades(nil)
+}
+
+func TestAnalyzeReturnsDiagnosticsPerRun(t *testing.T) {
+	setFlag(t, "require-tangent-ends", "true")
+	input := alignment("Radius,100,300", "Gerade,100", "Gerade,100")
+	for range 2 {
+		_, diags, _ := Analyze(parse(t, input), nil)
+		if len(diags) != 1 || diags[0].Severity != SeverityError {
+			t.Errorf("got %+v, want one error", diags)
+		}
+	}
+}
+
+func TestAnalyzeLogsToLogger(t *testing.T) {
+	var out bytes.Buffer
+	_, diags, err := Analyze(parse(t, alignment("Gerade,100")), slog.New(slog.NewTextHandler(&out, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range diags {
+		if !strings.Contains(out.String(), d.Message) {
+			t.Errorf("%q not logged", d.Message)
+		}
+	}
+	if len(diags) == 0 {
+		t.Error("no diagnostics")
+	}
+}
+
+func TestAnalyzeReturnsRuleErrors(t *testing.T) {
+	input := alignment("Gerade,100", "Radius,100,300", "Gerade,100", "Radius,100,-300", "Gerade,100")
+	for _, option := range []struct{ name, value, want string }{
+		{"straight-vp-mode", "median", "unknown straight vp mode (median)"},
+		{"bucket-boundary", "open", "unknown bucket boundary policy (open)"},
+		{"clothoid-radius", "far", "unknown clothoid radius convention (far)"},
+	} {
+		t.Run(option.name, func(t *testing.T) {
+			setFlag(t, option.name, option.value)
+			input := input
+			if option.name == "clothoid-radius" {
+				input = alignment("Gerade,100", "Klothoide,50", "Radius,100,300", "Gerade,100")
+			}
+			_, _, err := Analyze(parse(t, input), nil)
+			if err == nil || err.Error() != option.want {
+				t.Errorf("got %v, want %v", err, option.want)
+			}
+		})
+	}
+}
+
+func TestRuleLookupErrors(t *testing.T) {
+	if _, err := determineMaxGrade(42); err == nil {
+		t.Error("no error for a vp without maximum grade")
+	}
+	if _, err := determineMinSightRadius(42); err == nil {
+		t.Error("no error for a vp without sight distance")
+	}
+	setFlag(t, "clothoid-clamp", "false")
+	if _, err := determineMinClothoidLength(42); err == nil {
+		t.Error("no error for a vp without clothoid length")
+	}
+	if _, err := determineStraightVp(35, 100); err == nil {
+		t.Error("no error for a vp without straight vps")
+	}
+	if _, _, err := Analyze([]*Element{{ID: 1, Type: ElementType(7), Length: 10}}, nil); err == nil {
+		t.Error("no error for an unknown element type")
+	}
+}
+
+func TestParallelEachReturnsFirstError(t *testing.T) {
+	elements := make([]*Element, 1000)
+	for i := range elements {
+		elements[i] = &Element{ID: i}
+	}
+	err := parallelEach(elements, func(e *Element) error {
+		if e.ID%100 == 50 {
+			return fmt.Errorf("element %v", e.ID)
+		}
+		return nil
+	})
+	if err == nil || err.Error() != "element 50" {
+		t.Errorf("got %v, want the error of element 50", err)
+	}
+}
+
+func TestComputeRadiiKnownCircle(t *testing.T) {
+	// a straight heading north, a quarter circle of R=100 turning right
+	// and a straight heading east
+	elements := []*Element{
+		{ID: 1, Type: Straight, Length: 100, X: 0, Y: -100, HasCoords: true},
+		{ID: 2, Type: Radius, Length: 50 * math.Pi, X: 0, Y: 0, HasCoords: true},
+		{ID: 3, Type: Straight, Length: 100, X: 100, Y: 100, HasCoords: true},
+	}
+	computeRadii(elements, newFindings(nil))
+	if math.Abs(elements[1].Radius-100) > 1e-6 {
+		t.Errorf("got radius %v, want 100", elements[1].Radius)
+	}
+
+	// the same arc turning left
+	elements[2].X = -100
+	computeRadii(elements, newFindings(nil))
+	if math.Abs(elements[1].Radius+100) > 1e-6 {
+		t.Errorf("got radius %v, want -100", elements[1].Radius)
+	}
+}
+
+func TestComputeRadiiCollinear(t *testing.T) {
+	elements := []*Element{
+		{ID: 1, Type: Straight, Length: 100, X: 0, Y: -100, HasCoords: true},
+		{ID: 2, Type: Radius, Length: 100, X: 0, Y: 0, HasCoords: true},
+		{ID: 3, Type: Straight, Length: 100, X: 0, Y: 100, HasCoords: true},
+	}
+	found := newFindings(nil)
+	computeRadii(elements, found)
+	if elements[1].Type != Straight || len(found.diagnostics) != 1 {
+		t.Errorf("collinear radius not treated as straight: %v, %+v", elements[1].Type, found.diagnostics)
+	}
+}
+
+func TestArcRadius(t *testing.T) {
+	for _, radius := range []float64{15, 100, 2500} {
+		for _, angle := range []float64{0.1, 1, 3} {
+			length := radius * angle
+			chord := 2 * radius * math.Sin(angle/2)
+			if got := arcRadius(chord, length); math.Abs(got-radius) > 1e-6*radius {
+				t.Errorf("arcRadius(%v, %v) = %v, want %v", chord, length, got, radius)
+			}
+		}
+	}
+	if got := arcRadius(100, 100); got != 0 {
+		t.Errorf("straight chord gives radius %v", got)
+	}
+}
+
+func TestCantCheckOptIn(t *testing.T) {
+	input := alignment("Gerade,100", "Radius,50,30", "Gerade,100")
+	if e := analyze(t, input)[1]; hasFlag(e, ECant) || e.Cant <= 7 {
+		t.Errorf("cant %v flagged %v without -max-cant", e.Cant, hasFlag(e, ECant))
+	}
+	setFlag(t, "max-cant", "7")
+	if e := analyze(t, input)[1]; !hasFlag(e, ECant) {
+		t.Errorf("cant %v not flagged with -max-cant 7", e.Cant)
+	}
+}
+
+func TestCantTransitionOptIn(t *testing.T) {
+	input := alignment("Gerade,100", "Klothoide,40", "Radius,50,30", "Klothoide,40", "Gerade,100")
+	if e := analyze(t, input)[1]; hasFlag(e, ECantTransition) {
+		t.Errorf("cant transition flagged without -cant-rate")
+	}
+	setFlag(t, "cant-rate", "0.2")
+	if e := analyze(t, input)[1]; !hasFlag(e, ECantTransition) {
+		t.Errorf("clothoid of %v m for cant %v not flagged with -cant-rate 0.2", e.Length, e.Cant)
+	}
+}
+
+func TestGetDirectedNextRadiusFirstElement(t *testing.T) {
+	elements := []*Element{
+		{ID: 1, Type: Radius, Radius: 300},
+		{ID: 2, Type: Straight},
+		{ID: 3, Type: Clothoid},
+	}
+	if r, distance := getDirectedNextRadius(elements, 2, -1); r == nil || r.ID != 1 || distance != 2 {
+		t.Errorf("got %v at distance %v, want the radius at index 0", r, distance)
+	}
+	if r := getPreviousRadius(elements, 0); r != nil {
+		t.Errorf("got %v before the first element", r)
+	}
+	if r := getNextRadius(elements, 2); r != nil {
+		t.Errorf("got %v after the last element", r)
+	}
+}
+
+func TestBucketConflict(t *testing.T) {
+	// radii of 150 m allow 75 km/h, a straight of up to 160 m between them
+	// gets 85 km/h from its bucket. Between radii in the same direction it
+	// needs 5 s of driving, 104.2 m at 75 km/h and 118.1 m at 85 km/h.
+	for _, c := range []struct {
+		length    string
+		want, not Flag
+	}{
+		{"110", EMinLength | EBucketConflict, 0},
+		{"100", EMinLength, EBucketConflict},
+		{"120", 0, EMinLength | EBucketConflict},
+	} {
+		e := analyze(t, alignment("Gerade,100", "Radius,100,150", "Gerade,"+c.length, "Radius,100,150", "Gerade,100"))[2]
+		if e.Vp != 85 {
+			t.Fatalf("straight vp %v, want 85", e.Vp)
+		}
+		if flags := diagnosticFlags(e.Diagnostics); flags&c.want != c.want || flags&c.not != 0 {
+			t.Errorf("straight of %v m flagged %v", c.length, stringifyErrors(diagnosticFlags(e.Diagnostics))+stringifyWarnings(diagnosticFlags(e.Diagnostics)))
+		}
+	}
+}
+
+func TestVpDiffBoundary(t *testing.T) {
+	for _, c := range []struct {
+		strict  string
+		a, b    int
+		invalid bool
+	}{
+		{"true", 100, 80, true},
+		{"true", 80, 100, true},
+		{"true", 100, 81, false},
+		{"true", 90, 70, false},
+		{"true", 90, 69, true},
+		{"false", 100, 80, false},
+		{"false", 100, 79, true},
+		{"false", 90, 70, false},
+	} {
+		setFlag(t, "vp-boundary-strict", c.strict)
+		if got := vpDiffInvalid(c.a, c.b); got != c.invalid {
+			t.Errorf("strict %v: vpDiffInvalid(%v, %v) = %v", c.strict, c.a, c.b, got)
+		}
+		elements := []*Element{{ID: 1, Vp: c.a}, {ID: 2, Vp: c.b}}
+		checkVpDiffs(elements)
+		if hasFlag(elements[0], EVpDiff) != c.invalid || hasFlag(elements[1], EVpDiff) != c.invalid {
+			t.Errorf("strict %v: vps %v and %v flagged %v, %v", c.strict, c.a, c.b,
+				hasFlag(elements[0], EVpDiff), hasFlag(elements[1], EVpDiff))
+		}
+	}
+}
+
+func TestVpBoundaryConfigurable(t *testing.T) {
+	setFlag(t, "vp-boundary", "90")
+	if !vpDiffInvalid(90, 70) || vpDiffInvalid(100, 80) {
+		t.Error("the strict rule doesn't follow -vp-boundary")
+	}
+}
+
+// captureOutput redirects os.Stdout and os.Stderr to files while fn runs
+// and returns what was written to them
+func captureOutput(t *testing.T, fn func()) (stdout, stderr string) {
+	t.Helper()
+	outFile, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errFile, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldOut, oldErr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = outFile, errFile
+	defer func() { os.Stdout, os.Stderr = oldOut, oldErr }()
+	fn()
+	out, _ := os.ReadFile(outFile.Name())
+	errOut, _ := os.ReadFile(errFile.Name())
+	return string(out), string(errOut)
+}
+
+func TestProgressWritesToStderr(t *testing.T) {
+	stdout, stderr := captureOutput(t, func() {
+		p := &progress{enabled: true, total: 200, step: 2}
+		for i := 1; i <= 200; i++ {
+			p.update("radius vp", i)
+		}
+		p.clear()
+	})
+	if stdout != "" {
+		t.Errorf("progress written to stdout: %q", stdout)
+	}
+	if !strings.Contains(stderr, "radius vp: 100/200") || !strings.Contains(stderr, "radius vp: 200/200") {
+		t.Errorf("no progress on stderr: %q", stderr)
+	}
+	if strings.Contains(stderr, "radius vp: 101/200") {
+		t.Error("progress not limited to its steps")
+	}
+}
+
+func TestProgressDisabledWithoutTerminal(t *testing.T) {
+	setFlag(t, "progress", "true")
+	_, stderr := captureOutput(t, func() {
+		analyze(t, alignment("Gerade,100", "Radius,100,300", "Gerade,100"))
+	})
+	if stderr != "" {
+		t.Errorf("progress written to a file: %q", stderr)
+	}
+}
+
+func TestProgressClearedOnError(t *testing.T) {
+	setFlag(t, "progress", "true")
+	setFlag(t, "straight-vp-mode", "median")
+	old := isTerminal
+	isTerminal = func(*os.File) bool { return true }
+	defer func() { isTerminal = old }()
+	var err error
+	_, stderr := captureOutput(t, func() {
+		_, _, err = Analyze(parse(t, alignment("Radius,100,300", "Gerade,100", "Radius,100,400")), nil)
+	})
+	if err == nil {
+		t.Fatal("no error")
+	}
+	if !strings.Contains(stderr, "radius vp: 3/3") || !strings.HasSuffix(stderr, "\r\033[K") {
+		t.Errorf("progress line not cleared: %q", stderr)
+	}
+}
+
+// goldenAlignment is a small alignment with an error on the clothoid
+var goldenAlignment = alignment("Gerade,120", "Klothoide,40", "Radius,80,250", "Klothoide,60", "Gerade,200")
+
+func TestWriteCSVToGolden(t *testing.T) {
+	var out bytes.Buffer
+	writeCSVTo(&out, createTable(analyze(t, goldenAlignment), nil))
+	want, err := os.ReadFile("testdata/table.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != string(want) {
+		t.Errorf("got\n%v\nwant\n%v", out.String(), string(want))
+	}
+}
+
+func TestRenderTableToWriter(t *testing.T) {
+	var out bytes.Buffer
+	table := [][]string{{"ID", "Label"}, {"1", "a, b"}}
+	stdout, _ := captureOutput(t, func() {
+		renderTable(&out, table)
+	})
+	if stdout != "" {
+		t.Errorf("rendered to stdout: %q", stdout)
+	}
+	for _, row := range []string{`\|\s*ID\s*\|\s*Label\s*\|`, `\|\s*1\s*\|\s*a, b\s*\|`} {
+		if !regexp.MustCompile(row).MatchString(out.String()) {
+			t.Errorf("row %v missing in\n%v", row, out.String())
+		}
+	}
+}
+
+// withTotal replaces the empty total length in the footer of an alignment
+func withTotal(input, total string) string {
+	return strings.Replace(input, "Summe,,,,,,", "Summe,,,"+total+",,,", 1)
+}
+
+func TestCheckTotal(t *testing.T) {
+	setFlag(t, "check-total", "true")
+	input := alignment("Gerade,100", "Radius,50.5,300", "Gerade,100")
+	for _, c := range []struct {
+		total, want string
+	}{
+		{"250.5", ""},
+		{"250.505", ""},
+		{"260", "summed length 250.50 differs from declared total 260.00"},
+		{"", "footer row contains no total length"},
+		{"n/a", "couldn't convert total length n/a"},
+	} {
+		_, diags, err := Parse(strings.NewReader(withTotal(input, c.total)), optionsFromFlags())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.want == "" && len(diags) > 0 || c.want != "" && (len(diags) != 1 || diags[0].Severity != SeverityWarning || !strings.HasPrefix(diags[0].Message, c.want)) {
+			t.Errorf("total %q: got %+v, want %q", c.total, diags, c.want)
+		}
+	}
+}
+
+func TestRejectNonPositiveLength(t *testing.T) {
+	for _, length := range []string{"0", "-20"} {
+		input := alignment("Gerade,100", "Radius,"+length+",300", "Gerade,100")
+		elements, diags, err := Parse(strings.NewReader(input), optionsFromFlags())
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := fmt.Sprintf("line 5: non-positive length %v of element 2", length)
+		if len(elements) != 2 || len(diags) != 1 || diags[0].Message != want {
+			t.Errorf("length %v: got %v elements and %+v, want %q", length, len(elements), diags, want)
+		}
+	}
+}
+
+func TestTraversalTime(t *testing.T) {
+	// 100 m at 72 km/h (20 m/s) take 5 s
+	e := &Element{Length: 100, Vp: 72}
+	if got := traversalTime(e); math.Abs(got-5) > 1e-9 {
+		t.Errorf("got %v s, want 5 s", got)
+	}
+	if got := printTime(e); got != "5.0" {
+		t.Errorf("got %q, want 5.0", got)
+	}
+	if got := printTime(&Element{Length: 100}); got != "n/a" {
+		t.Errorf("got %q without vp, want n/a", got)
+	}
+}
+
+func TestAmbiguousClothoid(t *testing.T) {
+	elements := analyze(t, alignment("Gerade,100", "Radius,100,500", "Klothoide,50", "Radius,100,200", "Gerade,100"))
+	c := elements[2]
+	if !hasFlag(c, EAmbiguousClothoid) {
+		t.Error("clothoid between different radii not flagged")
+	}
+	if c.Vp != elements[3].Vp || c.AMin != elements[3].AMin || fmt.Sprint(c.Derivation.Sources) != "[4]" {
+		t.Errorf("clothoid vp %v from %v, want the vp %v of the tighter radius", c.Vp, c.Derivation.Sources, elements[3].Vp)
+	}
+
+	elements = analyze(t, alignment("Gerade,100", "Radius,100,300", "Klothoide,50", "Radius,100,300", "Gerade,100"))
+	if hasFlag(elements[2], EAmbiguousClothoid) {
+		t.Error("clothoid between equal radii flagged")
+	}
+}
+
+func TestFlagCodes(t *testing.T) {
+	want := map[Flag]string{
+		EVpDiff:            "TRAIL-E001",
+		EMinLength:         "TRAIL-E002",
+		ECant:              "TRAIL-E003",
+		EGrade:             "TRAIL-E004",
+		ESightDistance:     "TRAIL-E005",
+		EClothoidStraight:  "TRAIL-E006",
+		EMaxLength:         "TRAIL-E007",
+		ECantTransition:    "TRAIL-E008",
+		EStation:           "TRAIL-E009",
+		EParameter:         "TRAIL-E010",
+		EWidening:          "TRAIL-E011",
+		EARBounds:          "TRAIL-E012",
+		EGradeChange:       "TRAIL-E013",
+		EMaxStraight:       "TRAIL-E014",
+		EMissingClothoid:   "TRAIL-E015",
+		EBelowMinVp:        "TRAIL-E016",
+		EAmbiguousClothoid: "TRAIL-W001",
+		ECurvatureChange:   "TRAIL-W002",
+		EVpSpike:           "TRAIL-W003",
+		EMergeable:         "TRAIL-W004",
+		ETransitionLength:  "TRAIL-W005",
+		EBucketConflict:    "TRAIL-W006",
+		EAsymmetric:        "TRAIL-W007",
+		EIsolatedClothoid:  "TRAIL-W008",
+		EInflection:        "TRAIL-W009",
+	}
+	if len(want) != len(flagInfos) {
+		t.Errorf("%v flags, %v codes expected", len(flagInfos), len(want))
+	}
+	for f, code := range want {
+		if got := flagCodes(f); len(got) != 1 || got[0] != code {
+			t.Errorf("flag %v has codes %v, want %v", flagNames(f, SeverityError), got, code)
+		}
+	}
+	if got := stringifyCodes(EVpDiff | EVpSpike); got != "TRAIL-E001, TRAIL-W003" {
+		t.Errorf("got %q for two flags", got)
+	}
+}
+
+func TestWerrorExitCode(t *testing.T) {
+	// the only finding is the mergeable warning of the last straight
+	path := writeInput(t, alignment("Gerade,200", "Radius,100,300", "Gerade,200", "Gerade,200"))
+	if _, stderr, code := runMain(t, "-check-mergeable", "-strict", path); code != 0 {
+		t.Errorf("exit code %v for warnings only: %v", code, stderr)
+	}
+	if _, _, code := runMain(t, "-check-mergeable", "-werror", path); code != 1 {
+		t.Errorf("exit code %v with -werror, want 1", code)
+	}
+}
+
+func TestFailedWithWarnings(t *testing.T) {
+	elements := []*Element{{ID: 1}}
+	elements[0].report(EMergeable, 0, 0)
+	if failed(elements, nil) {
+		t.Error("a warning fails without -werror")
+	}
+	diags := []Diagnostic{{Severity: SeverityWarning, Message: "few elements"}}
+	if failed(nil, diags) {
+		t.Error("a warning diagnostic fails without -werror")
+	}
+	setFlag(t, "werror", "true")
+	if !failed(elements, nil) || !failed(nil, diags) {
+		t.Error("warnings don't fail with -werror")
+	}
+}
+
+// sampleInput returns the sample file with n elements
+func sampleInput(n int) string {
+	var b strings.Builder
+	writeSample(&b, n)
+	return b.String()
+}
+
+func TestParallelMatchesSequential(t *testing.T) {
+	input := sampleInput(20000)
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	sequential := createTable(analyze(t, input), nil)
+	runtime.GOMAXPROCS(8)
+	parallel := createTable(analyze(t, input), nil)
+	if !reflect.DeepEqual(sequential, parallel) {
+		t.Error("parallel results differ from sequential ones")
+	}
+}
+
+func BenchmarkParallelEach(b *testing.B) {
+	elements, _, err := Parse(strings.NewReader(sampleInput(100000)), optionsFromFlags())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for range b.N {
+		parallelEach(elements, func(e *Element) error {
+			if e.Type == Radius {
+				e.Vp = determineRadiusVp(e.Radius)
+				e.Cant = requiredCant(e.Vp, e.Radius)
+			}
+			return nil
+		})
+	}
+}
+
+// validVpRun returns n elements whose vps rise and fall in steps of 10 km/h,
+// so no adjacent pair exceeds the vp difference
+func validVpRun(n int) []*Element {
+	vps := []int{60, 70, 80, 90, 80, 70}
+	elements := make([]*Element, n)
+	for i := range elements {
+		elements[i] = &Element{ID: i + 1, Vp: vps[i%len(vps)], Length: 100}
+	}
+	return elements
+}
+
+func TestCheckVpDiffsAllocations(t *testing.T) {
+	elements := validVpRun(100000)
+	if allocs := testing.AllocsPerRun(10, func() { checkVpDiffs(elements) }); allocs != 0 {
+		t.Errorf("got %v allocations per run", allocs)
+	}
+	for _, e := range elements {
+		if e.Errors != 0 {
+			t.Fatalf("element %v flagged", e.ID)
+		}
+	}
+}
+
+// BenchmarkCheckVpDiffs measures the vp difference pass over a valid
+// alignment. It ran at about 0.5 ms and 0 allocations per 100k elements.
+func BenchmarkCheckVpDiffs(b *testing.B) {
+	elements := validVpRun(100000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		checkVpDiffs(elements)
+	}
+}
+
+// BenchmarkCheckVpDiffsFlagged measures the vp difference pass over an
+// alignment where every pair is invalid, so every element gets two
+// diagnostics. It ran at about 150 ms and 8 allocations per element, the
+// messages of the diagnostics are formatted right away.
+func BenchmarkCheckVpDiffsFlagged(b *testing.B) {
+	elements := make([]*Element, 100000)
+	for i := range elements {
+		elements[i] = &Element{ID: i + 1, Vp: 60 + 40*(i%2), Length: 100}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		for _, e := range elements {
+			e.Errors, e.Diagnostics = 0, e.Diagnostics[:0]
+		}
+		checkVpDiffs(elements)
+	}
+}
+
+// flagged returns elements with ids, where the given ids have an error
+func flagged(n int, invalid ...int) []*Element {
+	elements := make([]*Element, n)
+	for i := range elements {
+		elements[i] = &Element{ID: i + 1}
+	}
+	for _, id := range invalid {
+		elements[id-1].report(EMinLength, 0, 0)
+	}
+	return elements
+}
+
+// ids returns the ids of the elements
+func ids(elements []*Element) string {
+	var result []string
+	for _, e := range elements {
+		result = append(result, strconv.Itoa(e.ID))
+	}
+	return strings.Join(result, ",")
+}
+
+func TestSelectInvalidContext(t *testing.T) {
+	elements := flagged(10, 3, 5, 9)
+	selected, context := selectInvalid(elements, 1)
+	if got := ids(selected); got != "2,3,4,5,6,8,9,10" {
+		t.Errorf("selected %v", got)
+	}
+	var contextIDs []*Element
+	for _, e := range selected {
+		if context[e] {
+			contextIDs = append(contextIDs, e)
+		}
+	}
+	if got := ids(contextIDs); got != "2,4,6,8,10" {
+		t.Errorf("context %v", got)
+	}
+	if selected, _ := selectInvalid(elements, 0); ids(selected) != "3,5,9" {
+		t.Errorf("selected %v without context", ids(selected))
+	}
+}
+
+func TestContextRowsInTable(t *testing.T) {
+	table := createTable(selectInvalid(flagged(5, 3), 1))
+	if len(table) != 4 || table[1][13] != "(context)" || table[2][13] != "MinLength" || table[3][13] != "(context)" {
+		t.Errorf("got table %v", table)
+	}
+}
+
+func TestGradeFromElevation(t *testing.T) {
+	setFlag(t, "col-elevation", "5")
+	input := withColumn(alignment("Gerade,100", "Radius,100,300", "Gerade,100"), 5, "0", "10", "11")
+	elements := analyze(t, input)
+	if e := elements[0]; !e.HasGrade || e.Grade != 10 || !hasFlag(e, EGrade) {
+		t.Errorf("straight with grade %v at vp %v flagged %v", e.Grade, e.Vp, hasFlag(e, EGrade))
+	}
+	if e := elements[1]; e.Grade != 1 || hasFlag(e, EGrade) {
+		t.Errorf("radius with grade %v at vp %v flagged %v", e.Grade, e.Vp, hasFlag(e, EGrade))
+	}
+	if elements[2].HasGrade {
+		t.Error("the last element got a grade without following elevation")
+	}
+}
+
+func TestSightDistance(t *testing.T) {
+	input := alignment("Gerade,100", "Radius,100,300", "Gerade,100")
+	if e := analyze(t, input)[1]; hasFlag(e, ESightDistance) {
+		t.Error("radius 300 fails the sight check with 10 m clearance")
+	}
+	// 135 m at 90 km/h need 135² / (8 * 4) = 569.5 m with 4 m clearance
+	setFlag(t, "sight-offset", "4")
+	e := analyze(t, input)[1]
+	if !hasFlag(e, ESightDistance) {
+		t.Fatal("radius 300 passes the sight check with 4 m clearance")
+	}
+	d := diagnostic(t, e, ESightDistance)
+	if d.Actual != 300 || math.Abs(d.Limit-569.53) > 0.01 {
+		t.Errorf("got actual %v and limit %v", d.Actual, d.Limit)
+	}
+}
+
+func TestStringifyTypeFallback(t *testing.T) {
+	if got := stringifyType(Clothoid); got != "Clothoid" {
+		t.Errorf("got %q", got)
+	}
+	if got := ElementType(7).String(); got != "ElementType(7)" {
+		t.Errorf("got %q for an unknown type", got)
+	}
+}
+
+// BenchmarkParse and BenchmarkParseReadAll compare the allocations of
+// parsing row by row with reading the whole file first
+func BenchmarkParse(b *testing.B) {
+	input := sampleInput(100000)
+	opts := optionsFromFlags()
+	b.ReportAllocs()
+	for range b.N {
+		if _, _, err := Parse(strings.NewReader(input), opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseReadAll(b *testing.B) {
+	input := sampleInput(100000)
+	opts := optionsFromFlags()
+	b.ReportAllocs()
+	for range b.N {
+		reader := csv.NewReader(strings.NewReader(input))
+		reader.FieldsPerRecord = -1
+		rows, err := reader.ReadAll()
+		if err != nil {
+			b.Fatal(err)
+		}
+		var elements []*Element
+		for _, row := range rows[opts.HeaderRows : len(rows)-opts.FooterRows] {
+			e, err := readElement(row, opts.Columns)
+			if err != nil {
+				b.Fatal(err)
+			}
+			elements = append(elements, e)
+		}
+	}
+}
+
+func TestCSVErrorsOnly(t *testing.T) {
+	csvPath := t.TempDir() + "/out.csv"
+	stdout, stderr, code := runMain(t, "-all", "-csv-errors-only", "-csv", csvPath, writeInput(t, goldenAlignment))
+	if code != 0 {
+		t.Fatalf("exit code %v: %v", code, stderr)
+	}
+	out, err := os.ReadFile(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(bytes.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[1][0] != "2" {
+		t.Errorf("csv has rows %v, want the header and element 2", rows)
+	}
+	for id := 1; id <= 5; id++ {
+		if !hasRow(stdout, id) {
+			t.Errorf("element %v missing in the table:\n%v", id, stdout)
+		}
+	}
+}
+
+func TestClothoidStraight(t *testing.T) {
+	input := alignment("Gerade,100", "Radius,100,300", "Klothoide,50", "Gerade,20", "Klothoide,50", "Radius,100,-300", "Gerade,100")
+	if e := analyze(t, input)[3]; hasFlag(e, EClothoidStraight) {
+		t.Error("flagged without -min-clothoid-straight")
+	}
+	setFlag(t, "min-clothoid-straight", "30")
+	elements := analyze(t, input)
+	if e := elements[3]; !hasFlag(e, EClothoidStraight) {
+		t.Error("straight of 20 m between clothoids not flagged")
+	}
+	if e := elements[0]; hasFlag(e, EClothoidStraight) {
+		t.Error("straight next to a radius flagged")
+	}
+	setFlag(t, "min-clothoid-straight", "20")
+	if e := analyze(t, input)[3]; hasFlag(e, EClothoidStraight) {
+		t.Error("straight of exactly the minimum flagged")
+	}
+}
+
+func TestComputeMeanVp(t *testing.T) {
+	// 300 m at 100 km/h and 100 m at 60 km/h
+	elements := []*Element{{Length: 300, Vp: 100}, {Length: 100, Vp: 60}}
+	if mean, ok := ComputeMeanVp(elements); !ok || mean != 90 {
+		t.Errorf("got %v, %v, want 90", mean, ok)
+	}
+	if _, ok := ComputeMeanVp(nil); ok {
+		t.Error("mean of no elements")
+	}
+	if _, ok := ComputeMeanVp([]*Element{{Length: 0, Vp: 80}}); ok {
+		t.Error("mean of zero length")
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	elements := []*Element{{ID: 1, Length: 300, Vp: 100}, {ID: 2, Length: 100, Vp: 60}}
+	elements[1].report(EMinLength, 0, 0)
+	s := Summarize(elements)
+	if s.Elements != 2 || s.Invalid != 1 || s.TotalLength != 400 || !s.HasMeanVp || s.MeanVp != 90 {
+		t.Errorf("got %+v", s)
+	}
+}
+
+func TestSingleElement(t *testing.T) {
+	for _, element := range []string{"Gerade,100", "Radius,100,300", "Klothoide,50"} {
+		elements := analyze(t, alignment(element))
+		if len(elements) != 1 || elements[0].Vp == 0 {
+			t.Errorf("%v: got %+v", element, elements)
+		}
+		Summarize(elements)
+	}
+}
+
+func TestEmptyInput(t *testing.T) {
+	stdout, stderr, code := runMain(t, writeInput(t, alignment()))
+	if code != 0 || stdout != "no elements found\n" {
+		t.Errorf("exit code %v, output %q %v", code, stdout, stderr)
+	}
+}
+
+func TestClothoidRadiusConvention(t *testing.T) {
+	// a clothoid from a straight to a radius and one between two radii
+	input := alignment("Gerade,100", "Klothoide,50", "Radius,100,150", "Klothoide,50", "Radius,100,600", "Klothoide,50", "Gerade,100")
+	for _, c := range []struct {
+		convention      string
+		first, second   int
+		secondAmbiguous bool
+	}{
+		// the tighter radius
+		{"transition", 3, 3, true},
+		// the next radius at equal distance
+		{"nearest", 3, 5, false},
+	} {
+		setFlag(t, "clothoid-radius", c.convention)
+		elements := analyze(t, input)
+		for _, check := range []struct{ clothoid, radius int }{{1, c.first}, {3, c.second}} {
+			e := elements[check.clothoid]
+			if fmt.Sprint(e.Derivation.Sources) != fmt.Sprint([]int{check.radius}) || e.Vp != elements[check.radius-1].Vp {
+				t.Errorf("%v: clothoid %v follows %v, want radius %v", c.convention, e.ID, e.Derivation.Sources, check.radius)
+			}
+		}
+		if hasFlag(elements[3], EAmbiguousClothoid) != c.secondAmbiguous {
+			t.Errorf("%v: ambiguous %v", c.convention, hasFlag(elements[3], EAmbiguousClothoid))
+		}
+	}
+}
+
+func TestCountOnly(t *testing.T) {
+	stdout, stderr, code := runMain(t, "-count", writeInput(t, goldenAlignment))
+	if code != 0 || stdout != "1\n" {
+		t.Errorf("exit code %v, output %q %v", code, stdout, stderr)
+	}
+	stdout, _, _ = runMain(t, "-count", writeInput(t, alignment("Gerade,200", "Radius,100,300", "Gerade,200")))
+	if stdout != "0\n" {
+		t.Errorf("got %q for a valid alignment", stdout)
+	}
+}
+
+func TestMeanVpWithoutShortElements(t *testing.T) {
+	// a 10 m element at 40 km/h pulls the mean down
+	elements := []*Element{{Length: 300, Vp: 100}, {Length: 10, Vp: 40}, {Length: 100, Vp: 60}}
+	all, _ := ComputeMeanVp(elements)
+	filtered, ok := ComputeMeanVp(filterMinLength(elements, 20))
+	if !ok || filtered != 90 || math.Abs(all-88.78) > 0.01 {
+		t.Errorf("got %v for all and %v without short elements", all, filtered)
+	}
+	if _, ok := ComputeMeanVp(filterMinLength(elements, 1000)); ok {
+		t.Error("mean without any element")
+	}
+}
+
+func TestDeflection(t *testing.T) {
+	// a quarter circle turns by 90°
+	if got := deflection(&Element{Type: Radius, Length: 50 * math.Pi, Radius: -100}); math.Abs(got-90) > 1e-9 {
+		t.Errorf("got %v°, want 90°", got)
+	}
+	if got := deflection(&Element{Type: Straight, Length: 100}); got != 0 {
+		t.Errorf("got %v° for a straight", got)
+	}
+}
+
+func TestCurvatureChange(t *testing.T) {
+	setFlag(t, "max-curvature-rate", "0.0005")
+	// the curvature changes by 1/100 - 1/1000 = 0.009 1/m
+	elements := analyze(t, alignment("Gerade,100", "Radius,100,100", "Klothoide,10", "Radius,100,1000", "Gerade,100"))
+	for _, e := range []*Element{elements[1], elements[3]} {
+		if !hasFlag(e, ECurvatureChange) {
+			t.Errorf("radius %v not flagged", e.ID)
+		}
+	}
+	if d := diagnostic(t, elements[1], ECurvatureChange); math.Abs(d.Actual-0.009) > 1e-9 || math.Abs(d.Limit-0.005) > 1e-9 {
+		t.Errorf("got change %v and limit %v", d.Actual, d.Limit)
+	}
+	elements = analyze(t, alignment("Gerade,100", "Radius,100,100", "Klothoide,20", "Klothoide,20", "Radius,100,1000", "Gerade,100"))
+	if hasFlag(elements[1], ECurvatureChange) {
+		t.Error("flagged with 40 m of clothoids")
+	}
+}
+
+func TestStrictColumns(t *testing.T) {
+	input := strings.Replace(alignment("Gerade,100", "Radius,100,300", "Gerade,100"), "2,Radius,,100,,,300", "2,Radius,,100,,300", 1)
+	if _, _, err := Parse(strings.NewReader(input), optionsFromFlags()); err != nil {
+		t.Errorf("ragged row rejected without strict columns: %v", err)
+	}
+	setFlag(t, "strict-columns", "true")
+	_, _, err := Parse(strings.NewReader(input), optionsFromFlags())
+	if err == nil || err.Error() != "line 5 has 6 columns, but the header has 7" {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestHarmonicMeanVp(t *testing.T) {
+	// 100 m at 100 km/h and 100 m at 50 km/h: the arithmetic mean is
+	// 75 km/h, driving both takes as long as 200 m at 66.67 km/h
+	elements := []*Element{{Length: 100, Vp: 100}, {Length: 100, Vp: 50}}
+	arithmetic, _ := ComputeMeanVp(elements)
+	harmonic, ok := ComputeHarmonicMeanVp(elements)
+	if arithmetic != 75 || !ok || math.Abs(harmonic-200.0/3) > 1e-9 {
+		t.Errorf("got arithmetic %v and harmonic %v", arithmetic, harmonic)
+	}
+	if _, ok := ComputeHarmonicMeanVp([]*Element{{Length: 100}}); ok {
+		t.Error("harmonic mean without vp")
+	}
+}
+
+func TestHeaderMapReorderedColumns(t *testing.T) {
+	setFlag(t, "header-map", "3")
+	input := "Projekt,B1,,\nDatum,2020-01-01,,\nRadius,Länge,Typ,Nr\n,100,Gerade,1\n300,80,Radius,2\n,100,Gerade,3\nSumme,,,\n"
+	elements := parse(t, input)
+	if len(elements) != 3 {
+		t.Fatalf("got %v elements", len(elements))
+	}
+	if e := elements[1]; e.ID != 2 || e.Type != Radius || e.Length != 80 || e.Radius != 300 {
+		t.Errorf("got %+v", e)
+	}
+}
+
+func TestMapColumns(t *testing.T) {
+	cols := Columns{ID: 0, Type: 1, Length: 3, Radius: 6, A: -1, Label: -1, Direction: -1}
+	mapColumns([]string{" Label ", "RADIUS", "length", "unknown", "Richtung"}, &cols)
+	want := Columns{ID: 0, Type: 1, Length: 2, Radius: 1, A: -1, Label: 0, Direction: 4}
+	if cols != want {
+		t.Errorf("got %+v, want %+v", cols, want)
+	}
+}
+
+func TestRenumber(t *testing.T) {
+	setFlag(t, "renumber", "true")
+	setFlag(t, "renumber-base", "10")
+	input := strings.NewReplacer("\n2,", "\n7,", "\n3,", "\n9,").Replace(alignment("Gerade,100", "Radius,100,300", "Gerade,100"))
+	elements := analyze(t, input)
+	if got := ids(elements); got != "10,11,12" {
+		t.Errorf("renumbered to %v", got)
+	}
+	var orig []string
+	for _, e := range elements {
+		orig = append(orig, strconv.Itoa(e.OrigID))
+	}
+	if got := strings.Join(orig, ","); got != "1,7,9" {
+		t.Errorf("original ids %v", got)
+	}
+	if fmt.Sprint(elements[0].Derivation.Sources) != "[11]" {
+		t.Errorf("straight vp derives from %v, want the renumbered radius", elements[0].Derivation.Sources)
+	}
+}
+
+func TestVpSpike(t *testing.T) {
+	setFlag(t, "vp-spike", "10")
+	setFlag(t, "vp-spike-length", "50")
+	elements := []*Element{{ID: 1, Vp: 80, Length: 40}, {ID: 2, Vp: 100, Length: 40}, {ID: 3, Vp: 80, Length: 40}}
+	checkVpSpikes(elements)
+	if !hasFlag(elements[1], EVpSpike) || hasFlag(elements[0], EVpSpike) || hasFlag(elements[2], EVpSpike) {
+		t.Error("only the 100 km/h element should be a spike")
+	}
+	if d := diagnostic(t, elements[1], EVpSpike); d.Actual != 20 || d.Limit != 10 {
+		t.Errorf("got step %v and limit %v", d.Actual, d.Limit)
+	}
+
+	// a long element at 100 km/h is no spike, nor is a step up
+	for _, elements := range [][]*Element{
+		{{ID: 1, Vp: 80, Length: 40}, {ID: 2, Vp: 100, Length: 60}, {ID: 3, Vp: 80, Length: 40}},
+		{{ID: 1, Vp: 80, Length: 40}, {ID: 2, Vp: 100, Length: 40}, {ID: 3, Vp: 100, Length: 40}},
+	} {
+		checkVpSpikes(elements)
+		if hasFlag(elements[1], EVpSpike) {
+			t.Errorf("element of %v m between %v and %v km/h flagged", elements[1].Length, elements[0].Vp, elements[2].Vp)
+		}
+	}
+
+	// a dip
+	elements = []*Element{{ID: 1, Vp: 100, Length: 40}, {ID: 2, Vp: 80, Length: 40}, {ID: 3, Vp: 100, Length: 40}}
+	checkVpSpikes(elements)
+	if !hasFlag(elements[1], EVpSpike) {
+		t.Error("dip not flagged")
+	}
+}
+
+func TestParseOnlyReportsAllErrors(t *testing.T) {
+	input := alignment("Gerade,100", "Radius,x,300", "Bogen,100", "Gerade,100")
+	stdout, _, code := runMain(t, "-parse-only", writeInput(t, input))
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if code != 1 || len(lines) != 2 || !strings.HasPrefix(lines[0], "line 5:") || !strings.HasPrefix(lines[1], "line 6:") {
+		t.Errorf("exit code %v, output:\n%v", code, stdout)
+	}
+	stdout, _, code = runMain(t, "-parse-only", writeInput(t, goldenAlignment))
+	if code != 0 || stdout != "OK: 5 elements parsed\n" {
+		t.Errorf("exit code %v, output %q", code, stdout)
+	}
+}
+
+func TestBucketBoundary(t *testing.T) {
+	for _, tt := range []struct {
+		policy string
+		length float64
+		want   int
+	}{
+		{"inclusive", 140, 70},
+		{"exclusive", 140, 80},
+		{"inclusive", 139.9, 70},
+		{"exclusive", 140.1, 80},
+		{"inclusive", 180, 90},
+		{"exclusive", 180, MaxStraightVp},
+	} {
+		setFlag(t, "bucket-boundary", tt.policy)
+		radiusVp := 60
+		if tt.length == 180 {
+			radiusVp = 80
+		}
+		if vp, err := determineStraightVp(radiusVp, tt.length); err != nil || vp != tt.want {
+			t.Errorf("%v straight of %v m next to %v km/h: got %v, %v, want %v", tt.policy, tt.length, radiusVp, vp, err, tt.want)
+		}
+	}
+	setFlag(t, "bucket-boundary", "open")
+	if _, err := determineStraightVp(60, 140); err == nil {
+		t.Error("unknown policy accepted")
+	}
+}
+
+func TestMergeable(t *testing.T) {
+	input := alignment("Gerade,100", "Radius,80,300", "Radius,70,300", "Radius,50,400", "Gerade,100")
+	elements := analyze(t, input)
+	if hasFlag(elements[2], EMergeable) {
+		t.Error("mergeable elements flagged without -check-mergeable")
+	}
+	path := writeInput(t, alignment("Gerade,200", "Radius,100,300", "Gerade,200", "Gerade,200"))
+	if _, stderr, code := runMain(t, "-werror", path); code != 0 {
+		t.Errorf("exit code %v with -werror for adjacent straights: %v", code, stderr)
+	}
+
+	setFlag(t, "check-mergeable", "true")
+	elements = analyze(t, input)
+	if !hasFlag(elements[2], EMergeable) || hasFlag(elements[1], EMergeable) || hasFlag(elements[3], EMergeable) {
+		t.Error("only element 3 should be mergeable")
+	}
+
+	setFlag(t, "merge-adjacent", "true")
+	elements = analyze(t, input)
+	if len(elements) != 4 || elements[1].Length != 150 || elements[1].Radius != 300 {
+		t.Errorf("got %v elements, merged radius %+v", len(elements), elements[1])
+	}
+}
+
+func TestTotalsRow(t *testing.T) {
+	elements := analyze(t, goldenAlignment)
+	summary := Summarize(elements)
+	header := createTable(elements, nil)[0]
+	row := totalsRow(header, summary)
+	want := map[string]string{"ID": "TOTAL", "Type": "5 elements", "Length": "500.00", "Vp": printFloat(summary.MeanVp), "Radius": ""}
+	for i, column := range header {
+		if value, ok := want[column]; ok && row[i] != value {
+			t.Errorf("%v: got %q, want %q", column, row[i], value)
+		}
+	}
+
+	path := writeInput(t, goldenAlignment)
+	csvPath := t.TempDir() + "/out.csv"
+	stdout, _, _ := runMain(t, "-all", "-totals", "-csv", csvPath, path)
+	data, err := os.ReadFile(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout, "TOTAL") || strings.Contains(string(data), "TOTAL") {
+		t.Errorf("-totals should only add the row to the table:\n%v\n%s", stdout, data)
+	}
+	runMain(t, "-all", "-csv-totals", "-csv", csvPath, path)
+	if data, _ := os.ReadFile(csvPath); !strings.Contains(string(data), "TOTAL,5 elements,") {
+		t.Errorf("-csv-totals didn't add the row:\n%s", data)
+	}
+}
+
+func TestRequireElements(t *testing.T) {
+	path := writeInput(t, goldenAlignment)
+	stdout, _, code := runMain(t, "-header-rows", "4", "-footer-rows", "5", path)
+	if code != 0 || stdout != "no elements found\n" {
+		t.Errorf("exit code %v, output %q", code, stdout)
+	}
+	for _, flag := range []string{"-require-elements", "-strict"} {
+		_, stderr, code := runMain(t, flag, "-header-rows", "4", "-footer-rows", "5", path)
+		if code != 1 || !strings.Contains(stderr, "check -header-rows and -footer-rows") {
+			t.Errorf("%v: exit code %v, stderr %q", flag, code, stderr)
+		}
+	}
+}
+
+func TestWriteProfile(t *testing.T) {
+	elements := []*Element{{Length: 120, Vp: 100}, {Length: 40, Vp: 70}, {Length: 80, Vp: 60}}
+	for _, tt := range []struct {
+		step        float64
+		rows        int
+		first, last string
+	}{
+		{0, 5, "0.00,100", "240.00,60"},
+		{50, 7, "0.00,100", "240.00,60"},
+	} {
+		var b strings.Builder
+		writeProfile(&b, elements, tt.step)
+		rows := strings.Split(strings.TrimSpace(b.String()), "\n")
+		if len(rows) != tt.rows || rows[0] != "station,vp" || rows[1] != tt.first || rows[len(rows)-1] != tt.last {
+			t.Errorf("step %v: got\n%v", tt.step, b.String())
+		}
+	}
+}
+
+func TestDecodeInput(t *testing.T) {
+	input := "\ufeff" + goldenAlignment
+	elements, _, err := Parse(decodeInput(strings.NewReader(input)), optionsFromFlags())
+	if err != nil || len(elements) != 5 {
+		t.Fatalf("BOM input: %v elements, %v", len(elements), err)
+	}
+	data, _ := io.ReadAll(decodeInput(strings.NewReader("\ufeff1,Gerade")))
+	if string(data) != "1,Gerade" {
+		t.Errorf("BOM not stripped: %q", data)
+	}
+
+	setFlag(t, "encoding", "windows-1252")
+	data, err = io.ReadAll(decodeInput(strings.NewReader("Id,Typ,L\xe4nge\n")))
+	if err != nil || string(data) != "Id,Typ,Länge\n" {
+		t.Errorf("got %q, %v", data, err)
+	}
+}
+
+func TestStationMismatch(t *testing.T) {
+	setFlag(t, "col-station", "2")
+	input := withColumn(goldenAlignment, 2, "1000", "1120", "1160", "1250", "1310")
+	elements := analyze(t, input)
+	for _, e := range elements[:3] {
+		if hasFlag(e, EStation) {
+			t.Errorf("element %v flagged at station %v", e.ID, e.Station)
+		}
+	}
+	// the radius is 80 m long, not 90 m
+	if d := diagnostic(t, elements[3], EStation); d.Actual != 1250 || d.Limit != 1240 {
+		t.Errorf("got declared %v and computed %v", d.Actual, d.Limit)
+	}
+	if hasFlag(elements[4], EStation) {
+		t.Error("only the first divergence should be flagged")
+	}
+}
+
+func TestMaxRows(t *testing.T) {
+	csvPath := t.TempDir() + "/out.csv"
+	stdout, _, _ := runMain(t, "-all", "-max-rows", "2", "-csv", csvPath, writeInput(t, goldenAlignment))
+	if !hasRow(stdout, 1) || !hasRow(stdout, 2) || hasRow(stdout, 3) || !strings.Contains(stdout, "... (3 more)\n") {
+		t.Errorf("table not truncated after 2 rows:\n%v", stdout)
+	}
+	if data, _ := os.ReadFile(csvPath); strings.Count(string(data), "\n") != 6 {
+		t.Errorf("csv truncated:\n%s", data)
+	}
+
+	stdout, _, _ = runMain(t, "-all", "-max-rows", "5", writeInput(t, goldenAlignment))
+	if !hasRow(stdout, 5) || strings.Contains(stdout, "more)") {
+		t.Errorf("table of 5 rows truncated:\n%v", stdout)
+	}
+}
+
+func TestAbs(t *testing.T) {
+	if abs(-3) != 3 || abs(3) != 3 || abs(0) != 0 {
+		t.Error("abs is wrong")
+	}
+}
+
+func TestVpDiffInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		a, b    int
+		invalid bool
+	}{
+		{80, 100, true},
+		{100, 80, true},
+		{60, 80, false},
+		{80, 60, false},
+		{50, 71, true},
+		{70, 50, false},
+		{100, 100, false},
+	} {
+		if got := vpDiffInvalid(tt.a, tt.b); got != tt.invalid {
+			t.Errorf("%v to %v: got %v, want %v", tt.a, tt.b, got, tt.invalid)
+		}
+	}
+	setFlag(t, "vp-boundary-strict", "false")
+	if vpDiffInvalid(100, 80) {
+		t.Error("a difference of 20 at 100 km/h invalid without -vp-boundary-strict")
+	}
+}
+
+func TestCheckVpDiffs(t *testing.T) {
+	elements := []*Element{{ID: 1, Vp: 100}, {ID: 2, Vp: 70}, {ID: 3, Vp: 60}}
+	checkVpDiffs(elements)
+	if !hasFlag(elements[0], EVpDiff) || !hasFlag(elements[1], EVpDiff) || hasFlag(elements[2], EVpDiff) {
+		t.Error("only elements 1 and 2 should be flagged")
+	}
+	if d := diagnostic(t, elements[1], EVpDiff); d.Actual != 30 || d.Limit != 20 {
+		t.Errorf("got difference %v and limit %v", d.Actual, d.Limit)
+	}
+}
+
+func TestNeighborRadii(t *testing.T) {
+	elements := parse(t, alignment("Radius,100,300", "Klothoide,50", "Gerade,100", "Klothoide,50", "Klothoide,50", "Radius,100,500"))
+	for _, tt := range []struct {
+		pos                     int
+		previous, next, nearest int
+	}{
+		{0, 0, 6, 6},
+		{1, 1, 6, 1},
+		{2, 1, 6, 1},
+		{3, 1, 6, 6},
+		{5, 1, 0, 1},
+	} {
+		id := func(e *Element) int {
+			if e == nil {
+				return 0
+			}
+			return e.ID
+		}
+		previous, next, nearest := getPreviousRadius(elements, tt.pos), getNextRadius(elements, tt.pos), getNearestRadius(elements, tt.pos)
+		if id(previous) != tt.previous || id(next) != tt.next || id(nearest) != tt.nearest {
+			t.Errorf("element %v: got %v, %v, %v, want %v, %v, %v", tt.pos+1,
+				id(previous), id(next), id(nearest), tt.previous, tt.next, tt.nearest)
+		}
+	}
+}
+
+func TestPrintWorst(t *testing.T) {
+	elements := []*Element{
+		{ID: 1, Type: Straight, Vp: 80, Length: 100},
+		{ID: 2, Type: Straight, Vp: 80, Length: 90, MinLength: 100},
+		{ID: 3, Type: Clothoid, Vp: 80, Length: 50, MinLength: 100},
+		{ID: 4, Type: Radius, Vp: 80, Length: 100},
+		{ID: 5, Type: Radius, Vp: 120, Length: 100},
+		{ID: 6, Type: Straight, Vp: 80, Length: 100},
+	}
+	elements[1].report(EMinLength, 90, 100)
+	elements[2].report(EMinLength, 50, 100)
+	elements[3].report(EMergeable, 0, 0)
+	elements[4].report(EVpDiff, 40, 20)
+	for pos, want := range []float64{0, 20, 60, 5, 50, 0} {
+		if got := severityScore(elements, pos); math.Abs(got-want) > 1e-9 {
+			t.Errorf("element %v: score %v, want %v", pos+1, got, want)
+		}
+	}
+
+	stdout, _ := captureOutput(t, func() { printWorst(elements, 3) })
+	want := "worst elements:\n" +
+		"  1. #3 Clothoid (score 60.0): MinLength\n" +
+		"  2. #5 Radius (score 50.0): VpDiff\n" +
+		"  3. #2 Straight (score 20.0): MinLength\n"
+	if stdout != want {
+		t.Errorf("got\n%vwant\n%v", stdout, want)
+	}
+}
+
+func TestGivenParameterA(t *testing.T) {
+	setFlag(t, "col-a", "4")
+	input := withColumn(goldenAlignment, 4, "", "300", "", "125")
+	elements := analyze(t, input)
+	if elements[1].AMin >= 300 || elements[1].AMax >= 300 {
+		t.Fatalf("band %v to %v contains 300", elements[1].AMin, elements[1].AMax)
+	}
+	if d := diagnostic(t, elements[1], EParameter); d.Actual != 300 || d.Limit != elements[1].AMax {
+		t.Errorf("got A %v and limit %v", d.Actual, d.Limit)
+	}
+	if hasFlag(elements[1], EMinLength) || !hasFlag(elements[1], ETransitionLength) {
+		t.Error("a short clothoid with given A should fail the transition length only")
+	}
+	if elements[3].Errors != 0 {
+		t.Errorf("clothoid with A 125 in %v to %v flagged: %v", elements[3].AMin, elements[3].AMax, elements[3].Diagnostics)
+	}
+}
+
+func TestTargetVp(t *testing.T) {
+	summary := Summary{MeanVp: 65, HasMeanVp: true}
+	for _, tt := range []struct {
+		target    int
+		tolerance float64
+		want      bool
+	}{
+		{60, 0, true},
+		{65, 0, true},
+		{80, 0, false},
+		{80, 15, true},
+		{80, 14.9, false},
+	} {
+		if got := meetsTargetVp(summary, tt.target, tt.tolerance); got != tt.want {
+			t.Errorf("target %v with tolerance %v: got %v", tt.target, tt.tolerance, got)
+		}
+	}
+	if meetsTargetVp(Summary{}, 10, 0) {
+		t.Error("missing mean vp meets the target")
+	}
+
+	// a single 100 m radius has a vp of 65 km/h
+	path := writeInput(t, alignment("Radius,300,100"))
+	stdout, _, code := runMain(t, "-strict", "-target-vp", "80", path)
+	if code != 1 || !strings.Contains(stdout, "target vp 80 km/h: failed\n") {
+		t.Errorf("exit code %v, output:\n%v", code, stdout)
+	}
+	stdout, _, code = runMain(t, "-strict", "-target-vp", "60", path)
+	if code != 0 || !strings.Contains(stdout, "target vp 60 km/h: passed\n") {
+		t.Errorf("exit code %v, output:\n%v", code, stdout)
+	}
+}
+
+func TestClothoidClamp(t *testing.T) {
+	for _, vp := range []int{30, 105, 140} {
+		if _, err := determineMinClothoidLength(vp); err == nil {
+			t.Errorf("vp %v without clamping accepted", vp)
+		}
+	}
+	setFlag(t, "clothoid-clamp", "true")
+	for _, tt := range []struct {
+		vp   int
+		want float64
+	}{
+		{30, 15},
+		{40, 15},
+		{105, 61},
+		{130, 72},
+		{140, 72},
+	} {
+		if got, err := determineMinClothoidLength(tt.vp); err != nil || got != tt.want {
+			t.Errorf("vp %v: got %v, %v, want %v", tt.vp, got, err, tt.want)
+		}
+	}
+}
+
+func TestStraightVpMode(t *testing.T) {
+	// the radii have a vp of 75 and 100 km/h
+	input := alignment("Radius,100,150", "Gerade,60", "Radius,100,600")
+	for mode, want := range map[string]int{"max": 100, "min": 85, "avg": 90} {
+		setFlag(t, "straight-vp-mode", mode)
+		elements := analyze(t, input)
+		if elements[0].Vp != 75 || elements[2].Vp != 100 {
+			t.Fatalf("radius vps %v and %v", elements[0].Vp, elements[2].Vp)
+		}
+		if elements[1].Vp != want {
+			t.Errorf("%v: got straight vp %v, want %v", mode, elements[1].Vp, want)
+		}
+	}
+}
+
+func TestWidening(t *testing.T) {
+	input := alignment("Gerade,100", "Radius,80,-50", "Gerade,100", "Radius,80,500", "Gerade,100")
+	if elements := analyze(t, input); elements[1].Widening != 0 {
+		t.Errorf("widening %v without wheelbase", elements[1].Widening)
+	}
+
+	setFlag(t, "widening-wheelbase", "10")
+	setFlag(t, "max-widening", "1")
+	elements := analyze(t, input)
+	if elements[1].Widening != 2 || elements[3].Widening != 0.2 || elements[0].Widening != 0 {
+		t.Errorf("got widenings %v, %v and %v", elements[0].Widening, elements[1].Widening, elements[3].Widening)
+	}
+	if d := diagnostic(t, elements[1], EWidening); d.Actual != 2 || d.Limit != 1 {
+		t.Errorf("got widening %v and limit %v", d.Actual, d.Limit)
+	}
+	if hasFlag(elements[3], EWidening) {
+		t.Error("wide curve flagged")
+	}
+}
+
+func TestDegenerateAlignments(t *testing.T) {
+	messages := func(input string) string {
+		_, diags, err := Analyze(parse(t, input), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result []string
+		for _, d := range diags {
+			if d.Severity != SeverityWarning {
+				t.Errorf("%v isn't a warning", d.Message)
+			}
+			result = append(result, d.Message)
+		}
+		return strings.Join(result, "\n")
+	}
+	if got := messages(alignment("Gerade,100", "Gerade,200", "Gerade,300")); got != "the alignment has no radius, all vps are the maximum vp" {
+		t.Errorf("straights only: got %q", got)
+	}
+	if got := messages(alignment("Gerade,100", "Radius,100,300")); got != "only 2 elements, the analysis needs at least 3 to be meaningful" {
+		t.Errorf("2 elements: got %q", got)
+	}
+	if got := messages(goldenAlignment); got != "" {
+		t.Errorf("golden alignment: got %q", got)
+	}
+	setFlag(t, "min-elements", "6")
+	if got := messages(goldenAlignment); got != "only 5 elements, the analysis needs at least 6 to be meaningful" {
+		t.Errorf("-min-elements 6: got %q", got)
+	}
+}
+
+func TestCSVRaw(t *testing.T) {
+	input := alignment("Gerade,100", "Klothoide,15.123456789", "Radius,80,250", "Klothoide,60", "Gerade,200")
+	path := writeInput(t, input)
+	csvPath := t.TempDir() + "/out.csv"
+	stdout, _, _ := runMain(t, "-all", "-csv-raw", "-csv", csvPath, path)
+	data, err := os.ReadFile(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), ",15.123456789,") {
+		t.Errorf("csv lost precision:\n%s", data)
+	}
+	if !regexp.MustCompile(`\|\s*15\.12\s*\|`).MatchString(stdout) || strings.Contains(stdout, "15.123") {
+		t.Errorf("table not formatted:\n%v", stdout)
+	}
+
+	runMain(t, "-all", "-csv", csvPath, path)
+	if data, _ := os.ReadFile(csvPath); !strings.Contains(string(data), ",15.12,") {
+		t.Errorf("csv without -csv-raw not formatted:\n%s", data)
+	}
+}
+
+func TestLabelPassthrough(t *testing.T) {
+	setFlag(t, "col-label", "5")
+	labels := []string{"km 0,0", `Brücke "Nord"`, "", "Ende; Kurve", "km 0,5"}
+	quoted := make([]string, len(labels))
+	for i, label := range labels {
+		quoted[i] = `"` + strings.ReplaceAll(label, `"`, `""`) + `"`
+	}
+	input := withColumn(goldenAlignment, 5, quoted...)
+	elements := analyze(t, input)
+	for i, e := range elements {
+		if e.Label != labels[i] {
+			t.Errorf("element %v: got label %q, want %q", e.ID, e.Label, labels[i])
+		}
+	}
+	if plain := analyze(t, goldenAlignment); !reflect.DeepEqual(vps(plain), vps(elements)) {
+		t.Error("labels changed the vps")
+	}
+
+	dir := t.TempDir()
+	csvPath, jsonPath := dir+"/out.csv", dir+"/out.json"
+	runMain(t, "-all", "-col-label", "5", "-csv", csvPath, "-json-out", jsonPath, writeInput(t, input))
+	f, err := os.Open(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	column := slices.Index(rows[0], "Label")
+	for i, label := range labels {
+		if column < 0 || rows[i+1][column] != label {
+			t.Errorf("csv row %v: got %v, want label %q", i+1, rows[i+1], label)
+		}
+	}
+	data, _ := os.ReadFile(jsonPath)
+	if !strings.Contains(string(data), `"label": "km 0,0"`) || !strings.Contains(string(data), `"label": "Brücke \"Nord\""`) {
+		t.Errorf("labels missing in the json:\n%s", data)
+	}
+}
+
+// vps returns the vps of the elements
+func vps(elements []*Element) []int {
+	var result []int
+	for _, e := range elements {
+		result = append(result, e.Vp)
+	}
+	return result
+}
+
+func TestFailOn(t *testing.T) {
+	// the golden alignment only has a MinLength error
+	path := writeInput(t, goldenAlignment)
+	for _, tt := range []struct {
+		args []string
+		code int
+	}{
+		{nil, 0},
+		{[]string{"-strict"}, 1},
+		{[]string{"-fail-on", "VpDiff"}, 0},
+		{[]string{"-fail-on", "MinLength"}, 1},
+		{[]string{"-strict", "-fail-on", "VpDiff,Cant"}, 0},
+		{[]string{"-fail-on", "VpDiff,MinLength"}, 1},
+	} {
+		stdout, _, code := runMain(t, append(tt.args, path)...)
+		if code != tt.code {
+			t.Errorf("%v: exit code %v, want %v", tt.args, code, tt.code)
+		}
+		if !strings.Contains(stdout, "MinLength") {
+			t.Errorf("%v: MinLength not displayed:\n%v", tt.args, stdout)
+		}
+	}
+	if _, stderr, code := runMain(t, "-fail-on", "Short", path); code != 1 || !strings.Contains(stderr, "invalid -fail-on") {
+		t.Errorf("unknown flag name: exit code %v, stderr %q", code, stderr)
+	}
+}
+
+func TestStartEndVp(t *testing.T) {
+	// the golden alignment starts at 95 and ends at 100 km/h
+	setFlag(t, "start-vp", "70")
+	setFlag(t, "end-vp", "80")
+	elements := analyze(t, goldenAlignment)
+	if d := diagnostic(t, elements[0], EVpDiff); d.Actual != 25 || d.Limit != 20 {
+		t.Errorf("got difference %v and limit %v", d.Actual, d.Limit)
+	}
+	// a difference of 20 km/h at 100 km/h is already too large
+	if d := diagnostic(t, elements[4], EVpDiff); d.Actual != 20 {
+		t.Errorf("got difference %v at the end", d.Actual)
+	}
+	if hasFlag(elements[1], EVpDiff) {
+		t.Error("start vp flagged the second element")
+	}
+
+	setFlag(t, "start-vp", "80")
+	setFlag(t, "end-vp", "0")
+	elements = analyze(t, goldenAlignment)
+	if hasFlag(elements[0], EVpDiff) || hasFlag(elements[4], EVpDiff) {
+		t.Error("tie-ins within the allowed difference flagged")
+	}
+}
+
+func TestClothoidJustUnderMinimum(t *testing.T) {
+	minLength := analyze(t, goldenAlignment)[1].MinLength
+	short := strconv.FormatFloat(minLength-0.1, 'f', -1, 64)
+	input := alignment("Gerade,120", "Klothoide,"+short, "Radius,80,250", "Klothoide,60", "Gerade,200")
+	elements := analyze(t, input)
+	if d := diagnostic(t, elements[1], EMinLength); d.Limit != minLength {
+		t.Errorf("got limit %v, want %v", d.Limit, minLength)
+	}
+
+	// with a given A the length is checked as transition length
+	setFlag(t, "col-a", "4")
+	a := strconv.FormatFloat(math.Ceil(math.Sqrt(250*minLength)), 'f', -1, 64)
+	elements = analyze(t, withColumn(input, 4, "", a))
+	if hasFlag(elements[1], EMinLength) || hasFlag(elements[1], EParameter) {
+		t.Errorf("unexpected diagnostics %v", elements[1].Diagnostics)
+	}
+	if d := diagnostic(t, elements[1], ETransitionLength); d.Actual != minLength-0.1 || d.Limit != minLength {
+		t.Errorf("got length %v and limit %v", d.Actual, d.Limit)
+	}
+	input = alignment("Gerade,120", "Klothoide,"+strconv.FormatFloat(minLength, 'f', -1, 64), "Radius,80,250", "Klothoide,60", "Gerade,200")
+	if elements = analyze(t, withColumn(input, 4, "", a)); hasFlag(elements[1], ETransitionLength) {
+		t.Error("clothoid of the minimum length flagged")
+	}
+}
+
+func TestReportClamped(t *testing.T) {
+	input := alignment("Gerade,200", "Radius,100,2000", "Gerade,100", "Radius,100,300", "Gerade,200")
+	setFlag(t, "max-vp", "100")
+	elements := analyze(t, input)
+	if !elements[1].Clamped || elements[1].Vp != 100 || elements[3].Clamped || elements[0].Clamped {
+		t.Errorf("clamped %v, %v, %v at vp %v", elements[0].Clamped, elements[1].Clamped, elements[3].Clamped, elements[1].Vp)
+	}
+
+	stdout, _, _ := runMain(t, "-report-clamped", "-max-vp", "100", writeInput(t, input))
+	want := fmt.Sprintf("clamped radii:\n  #2 radius 2000.00 allows %v km/h, clamped to 100 km/h\nmean vp", determineRadiusVp(2000))
+	if !strings.Contains(stdout, want) {
+		t.Errorf("got\n%v\nwant\n%v", stdout, want)
+	}
+}
+
+func TestRowColor(t *testing.T) {
+	header := []string{"ID", "Length", "MinLength", "Errors", "Warnings"}
+	for _, tt := range []struct {
+		row  []string
+		want int
+	}{
+		{[]string{"1", "100.00", "50.00", "", ""}, tablewriter.Normal},
+		{[]string{"2", "95.00", "100.00", "MinLength", ""}, tablewriter.FgYellowColor},
+		{[]string{"3", "80.00", "100.00", "MinLength", ""}, tablewriter.FgRedColor},
+		{[]string{"4", "90.00", "100.00", "MinLength", ""}, tablewriter.FgRedColor},
+		{[]string{"5", "95.00", "100.00", "VpDiff, MinLength", ""}, tablewriter.FgRedColor},
+		{[]string{"6", "100.00", "50.00", "", "Mergeable"}, tablewriter.FgYellowColor},
+		{[]string{"7", "100.00", "50.00", "(context)", ""}, tablewriter.Normal},
+	} {
+		if got := rowColor(header, tt.row); got != tt.want {
+			t.Errorf("row %v: got color %v, want %v", tt.row[0], got, tt.want)
+		}
+	}
+	setFlag(t, "color-gross", "25")
+	if got := rowColor(header, []string{"3", "80.00", "100.00", "MinLength", ""}); got != tablewriter.FgYellowColor {
+		t.Errorf("20 %% below with -color-gross 25: got color %v", got)
+	}
+}
+
+func TestARBounds(t *testing.T) {
+	setFlag(t, "ar-bounds", "true")
+	if elements := analyze(t, goldenAlignment); hasFlag(elements[1], EARBounds) || hasFlag(elements[3], EARBounds) {
+		t.Error("clothoids within R/3 to R flagged")
+	}
+
+	// given A of 300 and 70 at R 250
+	setFlag(t, "col-a", "4")
+	elements := analyze(t, withColumn(goldenAlignment, 4, "", "300", "", "70"))
+	if d := diagnostic(t, elements[1], EARBounds); d.Actual != 1.2 || d.Limit != 1 {
+		t.Errorf("A > R: got ratio %v and limit %v", d.Actual, d.Limit)
+	}
+	if d := diagnostic(t, elements[3], EARBounds); d.Actual != 0.28 || d.Limit != 1.0/3 {
+		t.Errorf("A < R/3: got ratio %v and limit %v", d.Actual, d.Limit)
+	}
+
+	// without A it follows from the length
+	setFlag(t, "col-a", "-1")
+	elements = analyze(t, alignment("Gerade,100", "Klothoide,60", "Radius,40,50", "Klothoide,20", "Gerade,100"))
+	if d := diagnostic(t, elements[1], EARBounds); math.Abs(d.Actual-math.Sqrt(50*60)/50) > 1e-9 {
+		t.Errorf("got ratio %v", d.Actual)
+	}
+	if hasFlag(elements[3], EARBounds) {
+		t.Error("A of 31.6 at R 50 flagged")
+	}
+}
+
+func TestWorstVpTransition(t *testing.T) {
+	for _, tt := range []struct {
+		vps     []int
+		i, diff int
+	}{
+		{nil, -1, 0},
+		{[]int{80}, -1, 0},
+		{[]int{80, 80}, 1, 0},
+		{[]int{100, 90, 55, 70, 100, 65}, 2, 35},
+		{[]int{60, 80, 60}, 1, 20},
+	} {
+		var elements []*Element
+		for _, vp := range tt.vps {
+			elements = append(elements, &Element{Vp: vp})
+		}
+		if i, diff := WorstVpTransition(elements); i != tt.i || diff != tt.diff {
+			t.Errorf("%v: got %v at %v, want %v at %v", tt.vps, diff, i, tt.diff, tt.i)
+		}
+	}
+
+	// the golden alignment steps from 85 to 100 km/h at element 5
+	stdout, _, _ := runMain(t, writeInput(t, goldenAlignment))
+	if !strings.Contains(stdout, "worst vp step: 15 km/h at element #5\n") {
+		t.Errorf("worst vp step missing:\n%v", stdout)
+	}
+}
+
+func TestWriteTSV(t *testing.T) {
+	var b strings.Builder
+	writeTSV(&b, [][]string{{"ID", "Label"}, {"1", "km 0,5"}, {"2", "a\tb\nc"}})
+	if want := "ID\tLabel\n1\tkm 0,5\n2\ta b c\n"; b.String() != want {
+		t.Errorf("got %q, want %q", b.String(), want)
+	}
+
+	input := withColumn(goldenAlignment, 5, `"km 0,0"`)
+	stdout, _, _ := runMain(t, "-tsv", "-all", "-col-label", "5", writeInput(t, input))
+	lines := strings.Split(strings.TrimSuffix(stdout, "\n"), "\n")
+	header := strings.Split(lines[0], "\t")
+	column := slices.Index(header, "Label")
+	if column < 0 || len(lines) < 6 {
+		t.Fatalf("got\n%v", stdout)
+	}
+	for _, line := range lines[1:6] {
+		if fields := strings.Split(line, "\t"); len(fields) != len(header) {
+			t.Errorf("%q has %v fields, want %v", line, len(fields), len(header))
+		}
+	}
+	if label := strings.Split(lines[1], "\t")[column]; label != "km 0,0" {
+		t.Errorf("got label %q", label)
+	}
+}
+
+func TestGradeChange(t *testing.T) {
+	setFlag(t, "col-grade", "5")
+	setFlag(t, "max-grade-change", "4")
+	elements := analyze(t, withColumn(goldenAlignment, 5, "2", "2.5", "-3", "", "4"))
+	for i, want := range []bool{false, true, true, false, false} {
+		if hasFlag(elements[i], EGradeChange) != want {
+			t.Errorf("element %v: got %v, want %v", i+1, !want, want)
+		}
+	}
+	if d := diagnostic(t, elements[2], EGradeChange); d.Actual != 5.5 || d.Limit != 4 {
+		t.Errorf("got change %v and limit %v", d.Actual, d.Limit)
+	}
+}
+
+func TestComputeEnergy(t *testing.T) {
+	profile := func(vps ...int) []*Element {
+		var elements []*Element
+		for _, vp := range vps {
+			elements = append(elements, &Element{Vp: vp, Length: 100})
+		}
+		return elements
+	}
+	steady := ComputeEnergy(profile(80, 80, 80, 80, 80), 1500, 0.015)
+	oscillating := ComputeEnergy(profile(80, 60, 80, 60, 80), 1500, 0.015)
+	if oscillating <= steady {
+		t.Errorf("oscillating %v kWh, steady %v kWh", oscillating, steady)
+	}
+	// only the rolling resistance: 1500 kg * 9.81 m/s² * 0.015 * 500 m
+	if want := 1500 * 9.81 * 0.015 * 500 / 3.6e6; math.Abs(steady-want) > 1e-12 {
+		t.Errorf("steady %v kWh, want %v", steady, want)
+	}
+	if slowing := ComputeEnergy(profile(80, 60, 40, 40, 40), 1500, 0.015); slowing != steady {
+		t.Errorf("slowing down costs %v kWh, steady %v kWh", slowing, steady)
+	}
+}
+
+func TestNormalizeRadiusSign(t *testing.T) {
+	setFlag(t, "col-direction", "5")
+	input := withColumn(
+		alignment("Gerade,100", "Radius,100,300", "Gerade,100", "Radius,100,300", "Gerade,100", "Radius,100,-400", "Gerade,100", "Radius,100,-200", "Radius,100,500"),
+		5, "", "R", "", "L", "", "rechts", "", "links", "")
+	elements := parse(t, input)
+	found := newFindings(nil)
+	normalizeRadiusSigns(elements, found)
+	var radii []float64
+	for _, e := range elements {
+		if e.Type == Radius {
+			radii = append(radii, e.Radius)
+		}
+	}
+	if want := []float64{300, -300, 400, -200, 500}; !reflect.DeepEqual(radii, want) {
+		t.Errorf("got radii %v, want %v", radii, want)
+	}
+	if len(found.diagnostics) != 2 || !strings.Contains(found.diagnostics[0].Message, "radius 4 ") || !strings.Contains(found.diagnostics[1].Message, "radius 6 ") {
+		t.Errorf("got diagnostics %+v", found.diagnostics)
+	}
+
+	setFlag(t, "normalize-radius-sign", "true")
+	if elements := analyze(t, input); elements[3].Radius != -300 || elements[5].Radius != 400 {
+		t.Errorf("analysis didn't normalize: %v, %v", elements[3].Radius, elements[5].Radius)
+	}
+}
+
+func TestShowIndex(t *testing.T) {
+	setFlag(t, "show-index", "true")
+	input := withColumn(goldenAlignment, 0, "10", "20", "25", "7", "100")
+	elements := analyze(t, input)
+	table := createTable(elements, nil)
+	if table[0][0] != "Index" || table[0][1] != "ID" {
+		t.Fatalf("got header %v", table[0])
+	}
+	for i, row := range table[1:] {
+		if row[0] != strconv.Itoa(i) || row[1] != strconv.Itoa(elements[i].ID) || elements[i].Index != i {
+			t.Errorf("row %v starts with %v, %v", i, row[0], row[1])
+		}
+	}
+	if ref := elementRef(elements[3]); ref != "7 (index 3)" {
+		t.Errorf("got reference %q", ref)
+	}
+}
+
+func TestMaxStraight(t *testing.T) {
+	input := alignment("Gerade,1500", "Klothoide,40", "Radius,80,250", "Klothoide,60", "Gerade,3000")
+	if elements := analyze(t, input); hasFlag(elements[4], EMaxStraight) {
+		t.Error("flagged without -max-straight-factor")
+	}
+	setFlag(t, "max-straight-factor", "20")
+	elements := analyze(t, input)
+	if d := diagnostic(t, elements[4], EMaxStraight); d.Actual != 3000 || d.Limit != 2000 {
+		t.Errorf("got length %v and limit %v", d.Actual, d.Limit)
+	}
+	if hasFlag(elements[0], EMaxStraight) || hasFlag(elements[2], EMaxStraight) {
+		t.Error("element within the limit or no straight flagged")
+	}
+	if got := stringifyErrors(elements[4].Errors); !strings.Contains(got, "MaxStraight") {
+		t.Errorf("got errors %q", got)
+	}
+}
+
+func TestComputeVpBands(t *testing.T) {
+	// the golden alignment has 120 m at 95, 180 m at 85 and 200 m at 100 km/h
+	elements := analyze(t, goldenAlignment)
+	bands := ComputeVpBands(elements, []int{90, 100})
+	want := []VpBand{{Max: 90, Length: 180}, {Min: 90, Max: 100, Length: 120}, {Min: 100, Length: 200}}
+	if !reflect.DeepEqual(bands, want) {
+		t.Errorf("got %+v, want %+v", bands, want)
+	}
+	if bands := ComputeVpBands(elements, []int{85}); bands[0].Length != 0 || bands[1].Length != 500 {
+		t.Errorf("a vp at the bound belongs to the upper band, got %+v", bands)
+	}
+
+	if _, err := parseVpBands("100,80"); err == nil {
+		t.Error("descending bounds accepted")
+	}
+	stdout, _, _ := runMain(t, "-vp-bands", "90,100", writeInput(t, goldenAlignment))
+	if !strings.Contains(stdout, "vp bands:\n  < 90 km/h: 0.180 km (36.0%)\n  90-99 km/h: 0.120 km (24.0%)\n  >= 100 km/h: 0.200 km (40.0%)\n") {
+		t.Errorf("got\n%v", stdout)
+	}
+}
+
+func TestNoElementsToDisplay(t *testing.T) {
+	input := alignment("Gerade,120", "Klothoide,50", "Radius,80,250", "Klothoide,60", "Gerade,200")
+	stdout, _, code := runMain(t, writeInput(t, input))
+	if code != 0 || !strings.HasPrefix(stdout, "No elements to display (0 errors)\nmean vp: ") || strings.Contains(stdout, "|") {
+		t.Errorf("exit code %v, output:\n%v", code, stdout)
+	}
+	stdout, _, _ = runMain(t, "-all", writeInput(t, input))
+	if strings.Contains(stdout, "No elements to display") || !hasRow(stdout, 1) {
+		t.Errorf("-all printed no table:\n%v", stdout)
+	}
+}
+
+func TestShowNeighbors(t *testing.T) {
+	setFlag(t, "show-neighbors", "true")
+	input := alignment("Gerade,100", "Radius,100,300", "Klothoide,50", "Gerade,100", "Radius,100,-500", "Gerade,100")
+	elements := analyze(t, input)
+	table := createTable(elements, nil)
+	prev, next := slices.Index(table[0], "PrevRadiusId"), slices.Index(table[0], "NextRadiusId")
+	if prev < 0 || next < 0 {
+		t.Fatalf("got header %v", table[0])
+	}
+	for i, want := range [][2]string{{"", "2"}, {"", ""}, {"", ""}, {"2", "5"}, {"", ""}, {"5", ""}} {
+		if row := table[i+1]; row[prev] != want[0] || row[next] != want[1] {
+			t.Errorf("element %v: got %q and %q, want %q and %q", i+1, row[prev], row[next], want[0], want[1])
+		}
+	}
+	if elements[3].PrevRadiusID != 2 || elements[3].NextRadiusID != 5 {
+		t.Errorf("got %v and %v", elements[3].PrevRadiusID, elements[3].NextRadiusID)
+	}
+}
+
+func TestAutoFooter(t *testing.T) {
+	opts := optionsFromFlags()
+	opts.AutoFooter = true
+	withoutFooter := strings.TrimSuffix(goldenAlignment, "Summe,,,,,,\n")
+	for name, input := range map[string]string{
+		"one footer row":  goldenAlignment,
+		"two footer rows": goldenAlignment + "Stand,2020-01-02,,,,,\n",
+		"no footer":       withoutFooter,
+	} {
+		elements, diags, err := Parse(strings.NewReader(input), opts)
+		if err != nil || len(diags) > 0 {
+			t.Fatal(name, err, diags)
+		}
+		if len(elements) != 5 || elements[4].ID != 5 {
+			t.Errorf("%v: got elements %v", name, ids(elements))
+		}
+	}
+
+	// without -auto-footer the last element is lost
+	if elements := parse(t, withoutFooter); len(elements) != 4 {
+		t.Errorf("got elements %v", ids(elements))
+	}
+
+	// a label row between elements is no footer
+	input := strings.Replace(goldenAlignment, "3,Radius", "Kurve,,,,,,\n3,Radius", 1)
+	if _, diags, _ := Parse(strings.NewReader(input), opts); len(diags) != 1 || !strings.HasPrefix(diags[0].Message, "line 6:") {
+		t.Errorf("got diagnostics %+v", diags)
+	}
+}
+
+func TestMinLengthSeconds(t *testing.T) {
+	// straight 3 lies between radii in the same direction, straight 5 not
+	input := alignment("Gerade,200", "Radius,100,300", "Gerade,200", "Radius,100,300", "Gerade,200", "Radius,100,-300", "Klothoide,50", "Gerade,200")
+	check := func(radius, straight, sameDirection float64) {
+		t.Helper()
+		elements := analyze(t, input)
+		for i, seconds := range map[int]float64{1: radius, 2: sameDirection, 3: radius, 4: straight} {
+			e := elements[i]
+			if want := float64(e.Vp) / 3.6 * seconds; math.Abs(e.MinLength-want) > 1e-9 {
+				t.Errorf("%v %v at %v s: got min length %v, want %v", e.Type, e.ID, seconds, e.MinLength, want)
+			}
+		}
+		if e := elements[6]; e.MinLength != clothoidMinLengths[e.Vp] {
+			t.Errorf("clothoid min length %v changed", e.MinLength)
+		}
+	}
+	check(1, 1, 5)
+	setFlag(t, "radius-seconds", "2")
+	check(2, 1, 5)
+	setFlag(t, "straight-seconds", "3")
+	check(2, 3, 5)
+	setFlag(t, "same-direction-seconds", "7")
+	check(2, 3, 7)
+}
+
+func TestTruncateCell(t *testing.T) {
+	for _, tt := range []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{"VpDiff, MinLength, Cant", 10, "VpDiff, M…"},
+		{"MinLength", 9, "MinLength"},
+		{"MinLength", 8, "MinLeng…"},
+		{"Länge", 3, "Lä…"},
+	} {
+		if got := truncateCell(tt.s, tt.width); got != tt.want || len([]rune(got)) > tt.width {
+			t.Errorf("%q at %v: got %q, want %q", tt.s, tt.width, got, tt.want)
+		}
+	}
+
+	dir := t.TempDir()
+	csvPath, jsonPath := dir+"/out.csv", dir+"/out.json"
+	stdout, _, _ := runMain(t, "-max-col-width", "6", "-csv", csvPath, "-json-out", jsonPath, writeInput(t, goldenAlignment))
+	row := regexp.MustCompile(`(?m)^\|\s*2\s*\|.*$`).FindString(stdout)
+	if !strings.Contains(row, "MinLe…") || strings.Contains(row, "MinLength") {
+		t.Errorf("row not truncated:\n%v", stdout)
+	}
+	for _, path := range []string{csvPath, jsonPath} {
+		if data, _ := os.ReadFile(path); !strings.Contains(string(data), "MinLength") || strings.Contains(string(data), "…") {
+			t.Errorf("%v truncated:\n%s", path, data)
+		}
+	}
+}
+
+func TestMissingClothoid(t *testing.T) {
+	input := alignment("Gerade,100", "Radius,100,-300", "Klothoide,50", "Radius,100,250", "Klothoide,50", "Gerade,100", "Radius,100,1500", "Gerade,100")
+	setFlag(t, "missing-clothoid-radius", "1000")
+	elements := analyze(t, input)
+	for i, want := range []bool{false, true, false, false, false, false, false, false} {
+		if hasFlag(elements[i], EMissingClothoid) != want {
+			t.Errorf("element %v: got %v, want %v", i+1, !want, want)
+		}
+	}
+	if d := diagnostic(t, elements[1], EMissingClothoid); d.Actual != 300 || d.Limit != 1000 {
+		t.Errorf("got radius %v and limit %v", d.Actual, d.Limit)
+	}
+	setFlag(t, "missing-clothoid-radius", "0")
+	if elements := analyze(t, input); hasFlag(elements[1], EMissingClothoid) {
+		t.Error("flagged without -missing-clothoid-radius")
+	}
+}
+
+func TestBelowMinVp(t *testing.T) {
+	input := alignment("Gerade,200", "Klothoide,40", "Radius,100,100", "Klothoide,40", "Gerade,200")
+	setFlag(t, "min-vp", "70")
+	elements := analyze(t, input)
+	if elements[2].Vp != 65 {
+		t.Fatalf("radius has vp %v", elements[2].Vp)
+	}
+	for _, e := range elements {
+		if hasFlag(e, EBelowMinVp) != (e.Vp < 70) {
+			t.Errorf("%v %v at %v km/h: got %v", e.Type, e.ID, e.Vp, hasFlag(e, EBelowMinVp))
+		}
+	}
+	if d := diagnostic(t, elements[2], EBelowMinVp); d.Actual != 65 || d.Limit != 70 {
+		t.Errorf("got vp %v and limit %v", d.Actual, d.Limit)
+	}
+	if got := stringifyErrors(elements[2].Errors); !strings.Contains(got, "BelowMinVp") {
+		t.Errorf("got errors %q", got)
+	}
+}
+
+func TestSummaryKV(t *testing.T) {
+	keys := func(output string) []string {
+		var result []string
+		for _, line := range strings.Split(strings.TrimSuffix(output, "\n"), "\n") {
+			key, value, ok := strings.Cut(line, "=")
+			if !ok || value == "" || strings.ContainsAny(key, " :") {
+				t.Errorf("malformed line %q", line)
+			}
+			result = append(result, key)
+		}
+		return result
+	}
+	want := []string{"elements", "errors", "total_length", "mean_vp", "harmonic_mean_vp", "worst_vp_step", "worst_vp_step_id"}
+
+	stdout, _, code := runMain(t, "-summary-kv", writeInput(t, goldenAlignment))
+	if got := keys(stdout); code != 0 || !slices.Equal(got, want) {
+		t.Errorf("exit code %v, got keys %v, want %v", code, got, want)
+	}
+	if !strings.HasPrefix(stdout, "elements=5\nerrors=1\ntotal_length=500.00\nmean_vp=93.40\n") {
+		t.Errorf("got\n%v", stdout)
+	}
+
+	var b strings.Builder
+	writeSummaryKV(&b, Summary{Elements: 0})
+	if got := keys(b.String()); !slices.Equal(got, want[:3]) {
+		t.Errorf("empty summary: got keys %v", got)
+	}
+}
+
+func TestSymmetricClothoids(t *testing.T) {
+	setFlag(t, "symmetric-clothoids", "true")
+	input := alignment("Gerade,100", "Klothoide,40", "Radius,100,300", "Klothoide,80", "Gerade,100",
+		"Klothoide,60", "Radius,100,-300", "Klothoide,55", "Gerade,100", "Radius,100,500", "Klothoide,80", "Gerade,100")
+	elements := analyze(t, input)
+	if d := diagnostic(t, elements[2], EAsymmetric); d.Actual != 40 || d.Limit != 8 {
+		t.Errorf("got difference %v and limit %v", d.Actual, d.Limit)
+	}
+	// 5 m are within 10 % of 60 m, a curve without entry clothoid isn't checked
+	for _, i := range []int{1, 3, 6, 9} {
+		if hasFlag(elements[i], EAsymmetric) {
+			t.Errorf("%v %v flagged", elements[i].Type, elements[i].ID)
+		}
+	}
+}
+
+func TestDirectionColumn(t *testing.T) {
+	setFlag(t, "direction", "true")
+	input := alignment("Gerade,100", "Klothoide,50", "Radius,100,300", "Klothoide,50", "Gerade,100", "Radius,100,-400", "Gerade,100")
+	elements := analyze(t, input)
+	table := createTable(elements, nil)
+	column := slices.Index(table[0], "Direction")
+	radius := slices.Index(table[0], "Radius")
+	if column < 0 {
+		t.Fatalf("got header %v", table[0])
+	}
+	for i, want := range []string{"", "R", "R", "R", "", "L", ""} {
+		if got := table[i+1][column]; got != want {
+			t.Errorf("%v %v: got direction %q, want %q", elements[i].Type, elements[i].ID, got, want)
+		}
+	}
+	if table[3][radius] != "300.00" || table[6][radius] != "-400.00" {
+		t.Errorf("radii changed to %v and %v", table[3][radius], table[6][radius])
+	}
+	if got := printDirection(&Element{Type: Clothoid}); got != "—" {
+		t.Errorf("clothoid without radius: got %q", got)
+	}
+}
+
+func TestRequireTangentEnds(t *testing.T) {
+	input := alignment("Gerade,100", "Klothoide,50", "Radius,100,300")
+	if _, diags, _ := Analyze(parse(t, input), nil); len(diags) != 0 {
+		t.Errorf("got %+v without -require-tangent-ends", diags)
+	}
+	setFlag(t, "require-tangent-ends", "true")
+	_, diags, _ := Analyze(parse(t, input), nil)
+	if len(diags) != 1 || diags[0].Severity != SeverityError || diags[0].Message != "the alignment ends with Radius 3 instead of a straight" {
+		t.Errorf("got %+v", diags)
+	}
+	if _, diags, _ := Analyze(parse(t, goldenAlignment), nil); len(diags) != 0 {
+		t.Errorf("got %+v for tangent ends", diags)
+	}
+
+	_, stderr, code := runMain(t, "-require-tangent-ends", "-fail-on", "VpDiff", writeInput(t, input))
+	if code != 1 || !strings.Contains(stderr, "ends with Radius 3") {
+		t.Errorf("exit code %v, stderr %q", code, stderr)
+	}
+}
+
+func TestMinLengthDiagnostic(t *testing.T) {
+	elements := analyze(t, goldenAlignment)
+	e := elements[1]
+	d := diagnostic(t, e, EMinLength)
+	if d.Actual != 40 || d.Limit != e.MinLength || d.Limit != 50 {
+		t.Errorf("got actual %v and limit %v, want 40 and 50", d.Actual, d.Limit)
+	}
+	if d.Severity != SeverityError || d.Code != "TRAIL-E002" || d.Message != "MinLength: 40.00, limit 50.00" {
+		t.Errorf("got %+v", d)
+	}
+	if diagnosticFlags(e.Diagnostics) != e.Errors || e.Errors != EMinLength {
+		t.Errorf("flags %v don't match the diagnostics %+v", e.Errors, e.Diagnostics)
+	}
+	row := createTable(elements, nil)[2]
+	if !slices.Contains(row, "MinLength") {
+		t.Errorf("errors column missing in %v", row)
+	}
+}
+
+func TestBoundaryClothoid(t *testing.T) {
+	// the start of the alignment counts as a straight
+	elements := analyze(t, alignment("Klothoide,60", "Radius,100,300", "Klothoide,60", "Gerade,100"))
+	c, r := elements[0], elements[1]
+	if c.Vp != r.Vp || c.AMin != r.AMin || c.AMax != r.AMax || c.Turn != 1 {
+		t.Errorf("leading clothoid has vp %v, A %v to %v, want those of the radius %v, %v to %v", c.Vp, c.AMin, c.AMax, r.Vp, r.AMin, r.AMax)
+	}
+	if !reflect.DeepEqual(c.Derivation.Sources, []int{2}) || hasFlag(c, EIsolatedClothoid) || hasFlag(c, EAmbiguousClothoid) {
+		t.Errorf("got sources %v and flags %v", c.Derivation.Sources, c.Diagnostics)
+	}
+
+	// clothoids between an end and a straight have nothing to transition to
+	elements = analyze(t, alignment("Klothoide,60", "Gerade,100", "Klothoide,60", "Radius,100,300", "Gerade,100", "Klothoide,60"))
+	for i, want := range []bool{true, false, false, false, false, true} {
+		if hasFlag(elements[i], EIsolatedClothoid) != want {
+			t.Errorf("%v %v: got %v, want %v", elements[i].Type, elements[i].ID, !want, want)
+		}
+	}
+}
+
+func TestInputUnit(t *testing.T) {
+	feet := func(m float64) string { return strconv.FormatFloat(m/0.3048, 'g', -1, 64) }
+	input := alignment("Gerade,"+feet(120), "Klothoide,"+feet(40), "Radius,"+feet(80)+","+feet(250), "Klothoide,"+feet(60), "Gerade,"+feet(200))
+	want := analyze(t, goldenAlignment)
+
+	setFlag(t, "input-unit", "ft")
+	elements := analyze(t, input)
+	for i, e := range elements {
+		if math.Abs(e.Length-want[i].Length) > 1e-9 || math.Abs(e.Radius-want[i].Radius) > 1e-9 {
+			t.Errorf("element %v: got length %v and radius %v, want %v and %v", e.ID, e.Length, e.Radius, want[i].Length, want[i].Radius)
+		}
+		if e.Vp != want[i].Vp || e.Errors != want[i].Errors {
+			t.Errorf("element %v: got vp %v and flags %v, want %v and %v", e.ID, e.Vp, e.Errors, want[i].Vp, want[i].Errors)
+		}
+	}
+
+	setFlag(t, "input-unit", "cm")
+	if elements := parse(t, alignment("Gerade,12000")); elements[0].Length != 120 {
+		t.Errorf("got %v m", elements[0].Length)
+	}
+	setFlag(t, "input-unit", "")
+	setFlag(t, "length-scale", "0.5")
+	if elements := parse(t, alignment("Radius,100,300")); elements[0].Length != 50 || elements[0].Radius != 150 {
+		t.Errorf("got length %v and radius %v", elements[0].Length, elements[0].Radius)
+	}
+}
+
+func TestInflection(t *testing.T) {
+	elements := analyze(t, alignment("Gerade,100", "Radius,100,300", "Klothoide,60", "Klothoide,30", "Radius,100,-300", "Gerade,100"))
+	a, na := math.Sqrt(300*60), math.Sqrt(300*30)
+	for _, e := range elements[2:4] {
+		if d := diagnostic(t, e, EInflection); math.Abs(d.Actual-(a-na)) > 1e-9 || math.Abs(d.Limit-0.1*a) > 1e-9 {
+			t.Errorf("clothoid %v: got difference %v and limit %v", e.ID, d.Actual, d.Limit)
+		}
+	}
+
+	for name, input := range map[string]string{
+		"equal A":        alignment("Gerade,100", "Radius,100,300", "Klothoide,60", "Klothoide,60", "Radius,100,-300", "Gerade,100"),
+		"same direction": alignment("Gerade,100", "Radius,100,300", "Klothoide,60", "Klothoide,30", "Radius,100,600", "Gerade,100"),
+	} {
+		for _, e := range analyze(t, input) {
+			if hasFlag(e, EInflection) {
+				t.Errorf("%v: %v %v flagged", name, e.Type, e.ID)
+			}
+		}
+	}
+}
+
+func TestClothoidMaxFactor(t *testing.T) {
+	input := alignment("Gerade,120", "Klothoide,150", "Radius,80,250", "Klothoide,60", "Gerade,200")
+	if e := analyze(t, input)[1]; e.MaxLength != 0 || hasFlag(e, EMaxLength) {
+		t.Errorf("max length %v by default, flagged %v", e.MaxLength, stringifyErrors(e.Errors))
+	}
+	setFlag(t, "clothoid-max-factor", "2")
+	if e := analyze(t, input)[1]; e.MaxLength != 100 || !hasFlag(e, EMaxLength) {
+		t.Errorf("max length %v with factor 2, flagged %v", e.MaxLength, stringifyErrors(e.Errors))
+	}
+}
+
+func TestLengthEpsilon(t *testing.T) {
+	// the clothoid has a minimum length of 50 m and a maximum of 100 m
+	setFlag(t, "clothoid-max-factor", "2")
+	clothoid := func(length string) *Element {
+		t.Helper()
+		return analyze(t, alignment("Gerade,120", "Klothoide,"+length, "Radius,80,250", "Klothoide,60", "Gerade,200"))[1]
+	}
+	if e := clothoid("49.999"); e.Errors != EMinLength {
+		t.Errorf("without epsilon: got %v", stringifyErrors(e.Errors))
+	}
+
+	setFlag(t, "length-epsilon", "0.005")
+	for _, tt := range []struct {
+		length  string
+		flagged Flag
+	}{
+		{"49.996", 0},
+		{"49.99", EMinLength},
+		{"100.004", 0},
+		{"100.01", EMaxLength},
+	} {
+		if e := clothoid(tt.length); e.Errors != tt.flagged {
+			t.Errorf("clothoid of %v m: got %v, want %v", tt.length, stringifyErrors(e.Errors), stringifyErrors(tt.flagged))
+		}
+	}
+	setFlag(t, "length-epsilon", "0.01")
+	if shorter(49.995, 50) || !shorter(49.98, 50) || longer(100.005, 100) || !longer(100.02, 100) {
+		t.Error("shorter or longer ignores -length-epsilon")
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// tableView is the state of the -tui table. It works on the rows
+// of createTable and never changes them, sorting and filtering only affect
+// the visible rows.
+type tableView struct {
+	header     []string
+	rows       [][]string
+	sortColumn int
+	descending bool
+	errorsOnly bool
+	offset     int
+	pageSize   int
+}
+
+func newTableView(table [][]string, pageSize int) *tableView {
+	return &tableView{
+		header:     table[0],
+		rows:       table[1:],
+		sortColumn: -1,
+		pageSize:   pageSize,
+	}
+}
+
+// visible returns the filtered and sorted rows
+func (v *tableView) visible() [][]string {
+	var rows [][]string
+	errors := v.column("Errors")
+	for _, row := range v.rows {
+		if v.errorsOnly && (errors < 0 || row[errors] == "" || row[errors] == "(context)") {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	if v.sortColumn >= 0 {
+		sort.SliceStable(rows, func(i, j int) bool {
+			if v.descending {
+				return lessCell(rows[j][v.sortColumn], rows[i][v.sortColumn])
+			}
+			return lessCell(rows[i][v.sortColumn], rows[j][v.sortColumn])
+		})
+	}
+	return rows
+}
+
+// page returns the currently shown rows including the header
+func (v *tableView) page() [][]string {
+	rows := v.visible()
+	v.offset = max(0, min(v.offset, len(rows)-v.pageSize))
+	end := min(v.offset+v.pageSize, len(rows))
+	return append([][]string{v.header}, rows[v.offset:end]...)
+}
+
+// column returns the index of the named column or -1
+func (v *tableView) column(name string) int {
+	for i, column := range v.header {
+		if strings.EqualFold(column, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// scroll moves the page by n rows, keeping it filled
+func (v *tableView) scroll(n int) {
+	v.offset = max(0, min(v.offset+n, len(v.visible())-v.pageSize))
+}
+
+// sortBy sorts by the named column, sorting by the same column again
+// reverses the order
+func (v *tableView) sortBy(name string) error {
+	column := v.column(name)
+	if column < 0 {
+		return fmt.Errorf("unknown column %v", name)
+	}
+	if column == v.sortColumn {
+		v.descending = !v.descending
+	} else {
+		v.sortColumn, v.descending = column, false
+	}
+	v.offset = 0
+	return nil
+}
+
+// lessCell compares numerically if both cells are numbers and as text
+// otherwise. Empty cells sort first.
+func lessCell(a, b string) bool {
+	x, errX := strconv.ParseFloat(a, 64)
+	y, errY := strconv.ParseFloat(b, 64)
+	if errX == nil && errY == nil {
+		return x < y
+	}
+	return a < b
+}
+
+// tuiChrome is the number of lines around the rows of a page: the table
+// borders, its header and the status line
+const tuiChrome = 5
+
+// tuiModel is the bubbletea model of the -tui table. The arrow keys pick
+// the column s sorts by.
+type tuiModel struct {
+	view     *tableView
+	selected int
+}
+
+func (m *tuiModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	v := m.view
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		v.pageSize = max(1, msg.Height-tuiChrome)
+		v.scroll(0)
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "esc", "ctrl+c":
+			return m, tea.Quit
+		case "down", "j":
+			v.scroll(1)
+		case "up", "k":
+			v.scroll(-1)
+		case "pgdown", " ":
+			v.scroll(v.pageSize)
+		case "pgup":
+			v.scroll(-v.pageSize)
+		case "home", "g":
+			v.offset = 0
+		case "end", "G":
+			v.scroll(len(v.rows))
+		case "left", "h":
+			m.selected = max(0, m.selected-1)
+		case "right", "l":
+			m.selected = min(len(v.header)-1, m.selected+1)
+		case "s":
+			// the selected column always exists
+			v.sortBy(v.header[m.selected])
+		case "e":
+			v.errorsOnly = !v.errorsOnly
+			v.offset = 0
+		}
+	}
+	return m, nil
+}
+
+func (m *tuiModel) View() string {
+	v := m.view
+	page := v.page()
+	header := slices.Clone(v.header)
+	if v.descending {
+		header[v.sortColumn] += " ↓"
+	} else if v.sortColumn >= 0 {
+		header[v.sortColumn] += " ↑"
+	}
+	header[m.selected] = "[" + header[m.selected] + "]"
+	page[0] = header
+
+	var b strings.Builder
+	renderTable(&b, page)
+	filter := "all rows"
+	if v.errorsOnly {
+		filter = "rows with errors"
+	}
+	fmt.Fprintf(&b, "%v %v from %v. ←/→ column, s sort, e errors only, ↑/↓ pgup/pgdown scroll, q quit",
+		len(v.visible()), filter, v.offset+1)
+	return b.String()
+}
+
+// runTUI shows the table in a full screen terminal ui until it is quit
+func runTUI(table [][]string) error {
+	m := &tuiModel{view: newTableView(table, 20)}
+	_, err := tea.NewProgram(m, tea.WithAltScreen()).Run()
+	return err
+}
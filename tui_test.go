@@ -0,0 +1,106 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func tuiTable() [][]string {
+	return [][]string{
+		{"ID", "Length", "Errors"},
+		{"1", "120.00", ""},
+		{"2", "40.00", "MinLength"},
+		{"3", "9.50", ""},
+		{"4", "300.00", "(context)"},
+	}
+}
+
+func TestTableViewSortAndFilter(t *testing.T) {
+	v := newTableView(tuiTable(), 10)
+	if err := v.sortBy("length"); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, row := range v.visible() {
+		ids = append(ids, row[0])
+	}
+	if got := strings.Join(ids, ","); got != "3,2,1,4" {
+		t.Errorf("sorted numerically to %v, want 3,2,1,4", got)
+	}
+	v.sortBy("Length")
+	if v.visible()[0][0] != "4" {
+		t.Error("sorting again didn't reverse")
+	}
+	v.errorsOnly = true
+	if rows := v.visible(); len(rows) != 1 || rows[0][0] != "2" {
+		t.Errorf("errors only shows %v", rows)
+	}
+	if err := v.sortBy("Radius"); err == nil {
+		t.Error("no error for an unknown column")
+	}
+}
+
+func TestTableViewPages(t *testing.T) {
+	v := newTableView(tuiTable(), 3)
+	if page := v.page(); len(page) != 4 || page[1][0] != "1" {
+		t.Errorf("first page %v", page)
+	}
+	v.offset += v.pageSize
+	// the last page is filled up instead of showing a single row
+	if page := v.page(); len(page) != 4 || page[1][0] != "2" {
+		t.Errorf("last page %v", page)
+	}
+}
+
+func key(k string) tea.KeyMsg {
+	switch k {
+	case "right":
+		return tea.KeyMsg{Type: tea.KeyRight}
+	case "pgdown":
+		return tea.KeyMsg{Type: tea.KeyPgDown}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+}
+
+func TestTUIModel(t *testing.T) {
+	m := &tuiModel{view: newTableView(tuiTable(), 20)}
+	update := func(msg tea.Msg) tea.Cmd {
+		t.Helper()
+		_, cmd := m.Update(msg)
+		return cmd
+	}
+	update(tea.WindowSizeMsg{Width: 80, Height: tuiChrome + 2})
+	if m.view.pageSize != 2 {
+		t.Errorf("page size %v for two rows", m.view.pageSize)
+	}
+
+	update(key("right"))
+	update(key("s"))
+	view := m.View()
+	if !regexp.MustCompile(`\|\s*ID\s*\|\s*\[Length ↑\]\s*\|`).MatchString(view) ||
+		!regexp.MustCompile(`\|\s*3\s*\|\s*9\.50\s*\|`).MatchString(view) || hasRow(view, 4) {
+		t.Errorf("first page not sorted by length:\n%v", view)
+	}
+	update(key("pgdown"))
+	if view := m.View(); !hasRow(view, 4) || hasRow(view, 3) {
+		t.Errorf("second page not shown:\n%v", view)
+	}
+	update(key("s"))
+	if view := m.View(); !strings.Contains(view, "[Length ↓]") || !hasRow(view, 4) {
+		t.Errorf("sorting again didn't reverse:\n%v", view)
+	}
+
+	update(key("e"))
+	if view := m.View(); !hasRow(view, 2) || hasRow(view, 4) || !strings.Contains(view, "1 rows with errors") {
+		t.Errorf("errors only shows:\n%v", view)
+	}
+
+	if cmd := update(key("q")); cmd == nil {
+		t.Error("q doesn't quit")
+	} else if _, ok := cmd().(tea.QuitMsg); !ok {
+		t.Errorf("q returns %T", cmd())
+	}
+}